@@ -0,0 +1,354 @@
+package assert
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// anyKind 表示编译时无法确定的类型, 如嵌套字段, 下标和返回 Value 的函数
+const anyKind Kind = 255
+
+// TypeError 是类型检查发现的错误, 包含出错的位置
+type TypeError struct {
+	Position
+	Msg string
+}
+
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("type error at %s: %s", e.Position, e.Msg)
+}
+
+// Variables 返回表达式中读取的所有变量, 按第一次出现的顺序排列
+func (l *Assert) Variables() []string {
+	var (
+		names []string
+		seen  = make(map[string]bool)
+	)
+	walk(l.root, func(n node) bool {
+		if v, ok := n.(*variableNode); ok && !seen[v.name] {
+			seen[v.name] = true
+			names = append(names, v.name)
+		}
+		return true
+	})
+	return names
+}
+
+// Validate 按 schema 中给定的变量类型对表达式做类型检查, 不需要执行表达式.
+// schema 中不存在的变量会报错, 除非它是 schema 中某个 Object 类型变量的字段, 如 schema 中有 req 时的 req.host
+func (l *Assert) Validate(schema map[string]Kind) error {
+	c := checker{assert: l, schema: schema}
+	_, err := c.check(l.root)
+	return err
+}
+
+type checker struct {
+	assert *Assert
+	schema map[string]Kind
+}
+
+func (c *checker) errorf(n node, format string, args ...interface{}) error {
+	return &TypeError{
+		Position: position(c.assert.code, int(n.position())),
+		Msg:      fmt.Sprintf(format, args...),
+	}
+}
+
+func (c *checker) check(n node) (Kind, error) {
+	switch n := n.(type) {
+	case *literalNode:
+		return n.v.vType, nil
+	case *variableNode:
+		return c.variable(n)
+	case *unaryNode:
+		k, err := c.check(n.x)
+		if err != nil {
+			return k, err
+		}
+		if n.op == NOT {
+			return Boolean, nil
+		}
+		if !isNumeric(k, n.x) {
+			return k, c.errorf(n, "can not negate %s value", k)
+		}
+		return Number, nil
+	case *binaryNode:
+		return c.binary(n)
+	case *ternaryNode:
+		if _, err := c.check(n.cond); err != nil {
+			return anyKind, err
+		}
+		yes, err := c.check(n.yes)
+		if err != nil {
+			return yes, err
+		}
+		no, err := c.check(n.no)
+		if err != nil {
+			return no, err
+		}
+		if yes == no {
+			return yes, nil
+		}
+		return anyKind, nil
+	case *callNode:
+		return c.call(n)
+	case *listNode:
+		for _, item := range n.items {
+			if _, err := c.check(item); err != nil {
+				return List, err
+			}
+		}
+		return List, nil
+	case *fieldNode:
+		k, err := c.check(n.x)
+		if err != nil {
+			return k, err
+		}
+		if k != Object && k != anyKind && k != Nil {
+			return k, c.errorf(n, "can not access field of %s value", k)
+		}
+		return anyKind, nil
+	case *indexNode:
+		k, err := c.check(n.x)
+		if err != nil {
+			return k, err
+		}
+		if k != List && k != Object && k != anyKind && k != Nil {
+			return k, c.errorf(n, "can not index %s value", k)
+		}
+		if _, err := c.check(n.index); err != nil {
+			return anyKind, err
+		}
+		return anyKind, nil
+	}
+	return anyKind, nil
+}
+
+func (c *checker) variable(n *variableNode) (Kind, error) {
+	if k, ok := c.schema[n.name]; ok {
+		return k, nil
+	}
+	for i := len(n.path) - 1; i > 0; i-- {
+		if k, ok := c.schema[strings.Join(n.path[:i], ".")]; ok && (k == Object || k == anyKind) {
+			return anyKind, nil
+		}
+	}
+	return anyKind, c.errorf(n, "unknown variable '%s'", n.name)
+}
+
+func (c *checker) binary(n *binaryNode) (Kind, error) {
+	left, err := c.check(n.left)
+	if err != nil {
+		return left, err
+	}
+	right, err := c.check(n.right)
+	if err != nil {
+		return right, err
+	}
+	switch n.op {
+	case LT, GT, LTE, GTE, '+', '-', '*', '/', '%':
+		if left == Time || left == Duration || right == Time || right == Duration {
+			return c.temporal(n, left, right)
+		}
+	}
+	switch n.op {
+	case AND, OR:
+		if left == right {
+			return left, nil
+		}
+		return anyKind, nil
+	case COALESCE:
+		if left == right || left == Nil {
+			return right, nil
+		}
+		return anyKind, nil
+	case E, NE:
+		return Boolean, nil
+	case MATCH, IMATCH:
+		if lit, ok := n.right.(*literalNode); ok {
+			if _, err := globToRegexp(lit.v.String(), false, false); err != nil {
+				return Boolean, c.errorf(n.right, "%s", err)
+			}
+		}
+		return Boolean, nil
+	case INCIDR, NOTINCIDR:
+		if right != List && right != String && right != anyKind {
+			return Boolean, c.errorf(n, "can not check IP in %s value, should be CIDR or list of CIDR", right)
+		}
+		networks := []node{n.right}
+		if list, ok := n.right.(*listNode); ok {
+			networks = list.items
+		}
+		for _, x := range networks {
+			if lit, ok := x.(*literalNode); ok && lit.v.vType == String {
+				if _, err := parseCIDR(lit.v.String()); err != nil {
+					return Boolean, c.errorf(x, "%s", err)
+				}
+			}
+		}
+		return Boolean, nil
+	case LT, GT, LTE, GTE:
+		if !isNumeric(left, n.left) || !isNumeric(right, n.right) {
+			return Boolean, c.errorf(n, "can not compare %s value with %s value", left, right)
+		}
+		return Boolean, nil
+	case RE, NRE:
+		if left != String && left != anyKind {
+			return Boolean, c.errorf(n, "can not match regular expression on %s value", left)
+		}
+		if right != String && right != anyKind {
+			return Boolean, c.errorf(n, "regular expression must be a string, got %s value", right)
+		}
+		if lit, ok := n.right.(*literalNode); ok {
+			if _, err := precompileRegexp(lit.v.String()); err != nil {
+				return Boolean, c.errorf(n.right, "%s", err)
+			}
+		}
+		return Boolean, nil
+	case IN, NOTIN:
+		if right != List && right != String && right != Nil && right != anyKind {
+			return Boolean, c.errorf(n, "can not check membership in %s value", right)
+		}
+		return Boolean, nil
+	case '+':
+		if left == String || right == String {
+			for _, k := range []Kind{left, right} {
+				if k != String && k != Number && k != Boolean && k != anyKind {
+					return String, c.errorf(n, "can not concatenate %s value with string", k)
+				}
+			}
+			for _, x := range []node{n.left, n.right} {
+				if lit, ok := x.(*literalNode); ok && isText(lit.v) {
+					return String, nil
+				}
+			}
+			return anyKind, nil // 能解析成数字的字符串按数字相加
+		}
+		fallthrough
+	default: // -, *, /, %
+		if !isNumeric(left, n.left) || !isNumeric(right, n.right) {
+			return Number, c.errorf(n, "invalid operation between %s value and %s value", left, right)
+		}
+		if left == anyKind || right == anyKind {
+			return anyKind, nil
+		}
+		return Number, nil
+	}
+}
+
+// temporal 检查时间和时间段的比较与运算, 字符串可以转换成时间或时间段
+func (c *checker) temporal(n *binaryNode, left, right Kind) (Kind, error) {
+	is := func(k Kind, kinds ...Kind) bool {
+		for _, kind := range append(kinds, anyKind) {
+			if k == kind {
+				return true
+			}
+		}
+		return false
+	}
+	switch n.op {
+	case LT, GT, LTE, GTE:
+		// 数字可以作为 unix 时间戳与时间比较
+		if is(left, Time, String, Number) && is(right, Time, String, Number) || is(left, Duration, String) && is(right, Duration, String) {
+			return Boolean, nil
+		}
+		return Boolean, c.errorf(n, "can not compare %s value with %s value", left, right)
+	case '+':
+		switch {
+		case left == Time && is(right, Duration, String), right == Time && is(left, Duration, String):
+			return Time, nil
+		case is(left, Duration, String) && is(right, Duration, String):
+			return Duration, nil
+		}
+	case '-':
+		switch {
+		case left == Time && right == Duration:
+			return Time, nil
+		case left == Time && right == Number, left == Number && right == Time:
+			return Number, nil // 相差的秒数
+		case is(left, Time, String) && right == Time, left == Time && right == String:
+			if left == String || right == String {
+				return anyKind, nil // 字符串可能是时间, 也可能是时间段
+			}
+			return Duration, nil
+		case is(left, Duration, String) && is(right, Duration, String):
+			return Duration, nil
+		}
+	case '*':
+		if left == Duration && is(right, Number) || right == Duration && is(left, Number) {
+			return Duration, nil
+		}
+	case '/':
+		if left == Duration && is(right, Number) {
+			return Duration, nil
+		}
+		if left == Duration && is(right, Duration, String) {
+			return Number, nil
+		}
+	}
+	if left == anyKind || right == anyKind {
+		return anyKind, nil
+	}
+	return anyKind, c.errorf(n, "invalid operation between %s value and %s value", left, right)
+}
+
+func (c *checker) call(n *callNode) (Kind, error) {
+	for _, arg := range n.args {
+		if _, err := c.check(arg); err != nil {
+			return anyKind, err
+		}
+	}
+	f := c.assert.lookupFunc(n.name)
+	if f == nil {
+		return anyKind, c.errorf(n, "unknown function '%s'", n.name)
+	}
+	if err := f.checkArity(len(n.args)); err != nil {
+		return anyKind, c.errorf(n, "%s", err)
+	}
+	if f.native != nil {
+		return anyKind, nil
+	}
+	return kindOf(f.fn.Type().Out(0)), nil
+}
+
+// isNumeric 检查类型为 k 的节点 n 能否当作数字使用, 字符串常量可以转换成数字时也可以
+func isNumeric(k Kind, n node) bool {
+	switch k {
+	case Number, anyKind:
+		return true
+	case String:
+		if lit, ok := n.(*literalNode); ok {
+			_, err := strconv.ParseFloat(lit.v.String(), 64)
+			return err == nil
+		}
+	}
+	return false
+}
+
+func kindOf(t reflect.Type) Kind {
+	switch t {
+	case valueType:
+		return anyKind
+	case timeType:
+		return Time
+	case durationType:
+		return Duration
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return Boolean
+	case reflect.String:
+		return String
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return Number
+	case reflect.Slice, reflect.Array:
+		return List
+	case reflect.Map, reflect.Struct:
+		return Object
+	}
+	return anyKind
+}
@@ -5,9 +5,10 @@ package assert
 import (
 	"fmt"
 	"os"
-	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 	"unicode"
 
 	"github.com/pkg/errors"
@@ -18,6 +19,11 @@ const (
 	CUT = 100000
 )
 
+func init() {
+	// 语法错误中给出期望的 token
+	yyErrorVerbose = true
+}
+
 type KV interface {
 	Get(key string) interface{}
 }
@@ -27,6 +33,7 @@ type symbol struct {
 	t        int
 	variable bool   // 是否是一个变量
 	raw      string // 原生的字符串内容, 即表达式中的符号
+	pos      int    // 在表达式中的字节偏移量
 }
 
 func newSymbol(s string) symbol {
@@ -66,14 +73,23 @@ func newSymbol(s string) symbol {
 		item.t = GTE
 	case s == "<=":
 		item.t = LTE
+	case s == "in":
+		item.t = IN
+	case s == "imatch":
+		item.t = IMATCH
+	case s == "in_cidr":
+		item.t = INCIDR
+	case s == "??":
+		item.t = COALESCE
 	case len(s) >= 1 && unicode.IsNumber(rune(s[0])):
-		f, err := strconv.ParseFloat(s, 64)
-		if err == nil {
-			item.v = NewValue("", f)
+		if n, err := parseNumber(s); err == nil {
+			item.v = NewValue("", n)
+		} else if d, err := time.ParseDuration(s); err == nil { // 5m, 1h30m
+			item.v = NewValue("", d)
 		} else {
 			item.t = EOF
 		}
-	case len(s) == 1 && !unicode.IsLetter(rune(s[0])): // +, -, *, /, %
+	case len(s) == 1 && !unicode.IsLetter(rune(s[0])): // +, -, *, /, %, ,, ?, :
 		item.t = int(s[0])
 	case s == "true":
 		item.v = trueValue
@@ -87,93 +103,186 @@ func newSymbol(s string) symbol {
 	return item
 }
 
-// Assert 代表一个表达式
+// Assert 代表一个编译后的表达式, 编译后不可变, 可以被多个 goroutine 同时执行
 type Assert struct {
-	*sync.Mutex
-	data   []symbol
-	pos    int
-	answer Value
-	kv     KV
-	err    error
+	code  string
+	root  node
+	mu    sync.Mutex   // 保护 RegisterFunc 的并发写
+	funcs atomic.Value // map[string]*function, 写时复制
 }
 
 // New 编译代码生成表达式
 func New(code string) (*Assert, error) {
-	items, err := parse(strings.TrimSpace(code))
+	items, err := parse(code)
 	if err != nil {
 		return nil, err
 	}
-	return &Assert{
-		Mutex: &sync.Mutex{},
-		data:  items,
-	}, nil
+	l := &lexer{code: code, data: items}
+	yyParse(l)
+	if l.err != nil {
+		return nil, l.err
+	}
+	if err := precompile(code, l.root); err != nil {
+		return nil, err
+	}
+	return &Assert{code: code, root: l.root}, nil
+}
+
+// String 返回表达式的原始代码
+func (l *Assert) String() string {
+	return l.code
+}
+
+// lexer 在编译时为 yacc 提供 symbol, 并保存生成的语法树
+type lexer struct {
+	code   string
+	data   []symbol
+	pos    int
+	offset int // 最近一个 symbol 的位置, 用于报告语法错误
+	root   node
+	err    error
 }
 
 // Lex 为 yacc 使用
-func (l *Assert) Lex(lval *yySymType) int {
+func (l *lexer) Lex(lval *yySymType) int {
 	if l.pos >= len(l.data) {
+		l.offset = len(l.code)
 		return EOF
 	}
 	sb := l.data[l.pos]
 	l.pos++
+	l.offset = sb.pos
+	lval.pos = sb.pos
 
-	if sb.t == VALUE {
+	if sb.t == FUNC || sb.t == FIELD {
+		lval.op = sb.raw
+	} else if sb.t == VALUE {
 		if sb.variable {
-			if l.kv != nil {
-				switch instance := l.kv.(type) {
-				case pairs:
-					lval.value = instance.getValue(sb.raw)
-				default:
-					lval.value = NewValue(sb.raw, l.kv.Get(sb.raw))
-				}
-			}
+			lval.node = newVariableNode(sb.pos, sb.raw)
 		} else {
-			lval.value = sb.v
+			lval.node = &literalNode{pos: pos(sb.pos), v: sb.v}
 		}
 	}
 	return sb.t
 }
 
 // Error 为 yacc 所用
-func (l *Assert) Error(s string) {
+func (l *lexer) Error(s string) {
 	if s != "" {
-		l.err = errors.New(s)
+		l.err = &SyntaxError{Position: position(l.code, l.offset), Msg: strings.TrimPrefix(s, "syntax error: ")}
 		fmt.Fprintf(os.Stderr, "syntax error: %s\n", s)
 	}
 }
 
+// RegisterFunc 注册一个只在当前表达式中可用的函数, 同名时优先于全局函数, fn 的要求见全局的 RegisterFunc
+func (l *Assert) RegisterFunc(name string, fn interface{}) error {
+	f, err := newFunction(name, fn)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	old, _ := l.funcs.Load().(map[string]*function)
+	funcs := make(map[string]*function, len(old)+1)
+	for k, v := range old {
+		funcs[k] = v
+	}
+	funcs[name] = f
+	l.funcs.Store(funcs)
+	return nil
+}
+
+// lookupFunc 查找函数, 当前表达式中注册的函数优先
+func (l *Assert) lookupFunc(name string) *function {
+	funcs, _ := l.funcs.Load().(map[string]*function)
+	if f, ok := funcs[name]; ok {
+		return f
+	}
+	return lookupFunc(name)
+}
+
+// Evaluate 使用参数中给定的变量计算表达式的值, 用于计算非布尔的结果, 如 a ?? "default", code >= 500 ? "error" : "ok".
+// 执行过程中出现的错误通过 error 返回
+func (l *Assert) Evaluate(kv KV) (Value, error) {
+	e := evaluation{kv: kv}
+	e.funcs, _ = l.funcs.Load().(map[string]*function)
+	v := e.eval(l.root)
+	if err := v.Error(); err != nil {
+		return nilValue, err
+	}
+	return v, nil
+}
+
 // Execute 使用参数中给定的变量, 执行表达式并返回结果
 // 执行过程中出现任何错误都会返回 error, 比如字符串与数字比较等等
 func (l *Assert) Execute(kv KV) (bool, error) {
-	l.Lock()
-	defer l.Unlock()
-	l.kv = kv
-	yyParse(l)
-	l.pos = 0 // reset the pos
-	if l.err != nil {
-		return false, l.err
-	}
-	if err := l.answer.Error(); err != nil {
+	answer, err := l.Evaluate(kv)
+	if err != nil {
 		return false, err
 	}
-	return l.answer.Boolean(), nil
+	return answer.Boolean(), nil
+}
+
+// SyntaxError 是编译表达式时的语法错误, 包含出错的位置
+type SyntaxError struct {
+	Position
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at %s: %s", e.Position, e.Msg)
+}
+
+// Position 是表达式中的位置, Offset 为字节偏移量, Line 和 Column 从 1 开始, Column 按字符计算
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("line %d, column %d", p.Line, p.Column)
+}
+
+func position(code string, offset int) Position {
+	p := Position{Offset: offset, Line: 1, Column: 1}
+	for i, c := range code {
+		if i >= offset {
+			break
+		}
+		if c == '\n' {
+			p.Line++
+			p.Column = 1
+		} else {
+			p.Column++
+		}
+	}
+	return p
 }
 
-func parse(data string) ([]symbol, error) {
+// parse 将代码切分成 symbol, 首尾的空白字符会被忽略, symbol 的位置是在 code 中的偏移量
+func parse(code string) ([]symbol, error) {
+	data := strings.TrimRightFunc(code, unicode.IsSpace)
 	items := make([]symbol, 0, 8)
 	var (
 		// prevState         = 0
-		state, start, cut = 0, 0, false
-		err               error
+		state, cut = 0, false
+		start      = len(data) - len(strings.TrimLeftFunc(data, unicode.IsSpace))
+		err        error
 	)
-	for i := 0; i < len(data); {
+	appendSymbol := func(unit string, offset int) {
+		trimmed := strings.TrimSpace(unit)
+		item := newSymbol(trimmed)
+		item.pos = offset + len(unit) - len(strings.TrimLeftFunc(unit, unicode.IsSpace))
+		items = append(items, item)
+	}
+	for i := start; i < len(data); {
 		// prevState = state
 		state, cut, err = nextState(state, rune(data[i]))
 		if err != nil {
-			return nil, errors.Wrap(err, "syntax error")
+			return nil, &SyntaxError{Position: position(code, i), Msg: err.Error()}
 		} else if cut {
-			unit := strings.TrimSpace(data[start:i])
-			items = append(items, newSymbol(unit))
+			appendSymbol(data[start:i], start)
 			/*
 				if prevState == 10 { // 10 表示是个变量
 				}
@@ -183,7 +292,23 @@ func parse(data string) ([]symbol, error) {
 			i++
 		}
 	}
-	items = append(items, newSymbol(strings.TrimSpace(data[start:])))
+	appendSymbol(data[start:], start)
+	for i := 0; i < len(items)-1; i++ {
+		switch {
+		case items[i].variable && items[i+1].t == LB: // 紧跟着左括号的变量是函数调用
+			items[i].t = FUNC
+			items[i].variable = false
+		case items[i+1].variable && strings.HasPrefix(items[i+1].raw, ".") && (items[i].t == ']' || items[i].t == RB): // items[0].name
+			items[i+1].t = FIELD
+			items[i+1].variable = false
+		case items[i].raw == "not" && items[i+1].t == IN: // not in
+			items[i] = symbol{raw: "not in", v: nilValue, t: NOTIN, pos: items[i].pos}
+			items = append(items[:i+1], items[i+2:]...)
+		case items[i].raw == "not" && items[i+1].t == INCIDR: // not in_cidr
+			items[i] = symbol{raw: "not in_cidr", v: nilValue, t: NOTINCIDR, pos: items[i].pos}
+			items = append(items[:i+1], items[i+2:]...)
+		}
+	}
 	return items, nil
 }
 
@@ -200,8 +325,10 @@ func nextState(state int, c rune) (int, bool, error) {
 		}
 
 		switch c {
-		case '+', '-', '*', '/', '%', '(', ')':
+		case '+', '-', '*', '/', '%', '(', ')', ',', '[', ']', ':':
 			return CUT, false, nil
+		case '?': // ?, ??
+			return 12, false, nil
 		case '|': // ||
 			return 3, false, nil
 		case '&': // &&
@@ -227,11 +354,15 @@ func nextState(state int, c rune) (int, bool, error) {
 			return 1, false, nil
 		} else if c == '.' {
 			return 2, false, nil
+		} else if unicode.IsLetter(c) {
+			return 11, false, nil
 		}
 		return 0, true, nil
 	case 2: // float
 		if unicode.IsNumber(c) {
 			return 2, false, nil
+		} else if unicode.IsLetter(c) {
+			return 11, false, nil
 		}
 		return 0, true, nil
 	case 3: // ||
@@ -278,6 +409,16 @@ func nextState(state int, c rune) (int, bool, error) {
 			return 10, false, nil
 		}
 		return 0, true, nil
+	case 12: // ?, ??
+		if c == '?' {
+			return CUT, false, nil
+		}
+		return 0, true, nil
+	case 11: // duration, 如 5m, 1h30m, 1.5s
+		if unicode.IsLetter(c) || unicode.IsNumber(c) || c == '.' {
+			return 11, false, nil
+		}
+		return 0, true, nil
 	case CUT:
 		return 0, true, nil
 	}
@@ -364,23 +505,16 @@ func MustExecuteMap(code string, data map[string]interface{}) bool {
 	return b
 }
 
-// Equal check if the two assert expression is equal, (mainly ignore the white space charactors)
+// Equal check if the two assert expression is equal, it compares the normalized code, so
+// the white space charactors, redundant parentheses and operand order of commutative operators are ignored, see Assert.Normalize
 func Equal(code1, code2 string) bool {
-	items1, err := parse(strings.TrimSpace(code1))
+	exp1, err := New(code1)
 	if err != nil {
 		return false
 	}
-	items2, err := parse(strings.TrimSpace(code2))
+	exp2, err := New(code2)
 	if err != nil {
 		return false
 	}
-	if len(items1) != len(items2) {
-		return false
-	}
-	for i := 0; i < len(items1); i++ {
-		if items1[i] != items2[i] {
-			return false
-		}
-	}
-	return true
+	return exp1.Normalize().String() == exp2.Normalize().String()
 }
@@ -1,9 +1,14 @@
 package assert
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -112,7 +117,7 @@ func TestAssert_ExecuteNormal(t *testing.T) {
 	for i := 0; i < 20; i++ {
 		go func() {
 			defer wait.Done()
-			result, err = expr.Execute(NewKV(map[string]interface{}{
+			result, err := expr.Execute(NewKV(map[string]interface{}{
 				"host":  "172.16.50.50",
 				"time":  1533791996370402301,
 				"usage": 65.14931404914708,
@@ -304,15 +309,8 @@ func TestAssert_Error(t *testing.T) {
 	assert.Error(t, err)
 	t.Log(err.Error())
 
-	expr, err = New(`value =~ "wskl).]"`)
-	if err != nil {
-		t.Fatal(err)
-	}
-	_, err = expr.Execute(
-		NewKV(map[string]interface{}{
-			"value": 1000,
-		}),
-	)
+	// 常量的正则在编译时检查
+	_, err = New(`value =~ "wskl).]"`)
 	assert.Error(t, err)
 	t.Log(err.Error())
 
@@ -408,6 +406,13 @@ func TestEqual(t *testing.T) {
 	assert.True(t, Equal("", ""))
 	assert.True(t, Equal("a==2", "a == 2"))
 	assert.False(t, Equal("a=2", "a == 2"))
+	assert.True(t, Equal("a > 1 && b", "b && a > 1"))
+	assert.True(t, Equal("(a)", "a"))
+	assert.True(t, Equal("a > 1 + 1", "2 < a"))
+	assert.True(t, Equal("(a || b) && c", "c && (b || a)"))
+	assert.False(t, Equal("(a || b) && c", "a || b && c"))
+	assert.False(t, Equal("a - b", "b - a"))
+	assert.False(t, Equal("a ==", "a =="))
 }
 
 func BenchmarkAssert(b *testing.B) {
@@ -425,3 +430,1281 @@ func BenchmarkAssert(b *testing.B) {
 		expri.Execute(kv)
 	}
 }
+
+func TestAssert_ExecuteFunc(t *testing.T) {
+	kv := NewKV(map[string]interface{}{
+		"path": "/api/v1",
+		"host": "WEB",
+		"cpu":  57,
+	})
+	for code, expect := range map[string]bool{
+		`len(path) > 3`:                    true,
+		`lower(host) == "web"`:             true,
+		`upper(lower(host)) == host`:       true,
+		`abs(cpu - 50) < 10`:               true,
+		`abs(50 - cpu) < 5`:                false,
+		`contains(path, "v1")`:             true,
+		`hasPrefix(path, "/api") && true`:  true,
+		`hasSuffix(path, "v2")`:            false,
+		`min(cpu, 10, 20) == 10`:           true,
+		`max(cpu, 10, 20) == 57`:           true,
+		`round(2.6) == 3`:                  true,
+		`now() > 0`:                        true,
+		`now() > "2020-01-01T00:00:00Z"`:   true,
+		`len("监控") == 2 && len(path) == 7`: true,
+	} {
+		result, err := Execute(code, kv)
+		if assert.NoError(t, err, code) {
+			assert.Equal(t, expect, result, code)
+		}
+	}
+
+	for _, code := range []string{
+		`len(path, host) > 3`, // arity
+		`abs(host) > 3`,       // type
+		`min() > 3`,
+		`unknown(path)`,
+	} {
+		_, err := Execute(code, kv)
+		assert.Error(t, err, code)
+		t.Log(err)
+	}
+}
+
+func TestAssert_RegisterFunc(t *testing.T) {
+	expr, err := New(`double(value) == 20 && ok(value)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, expr.RegisterFunc("double", func(f float64) float64 { return f * 2 }))
+	assert.NoError(t, expr.RegisterFunc("ok", Func(func(args ...Value) Value {
+		return NewValue("", len(args) == 1)
+	})))
+	result, err := expr.Execute(NewKV(map[string]interface{}{"value": 10}))
+	assert.NoError(t, err)
+	assert.True(t, result)
+
+	_, err = Execute(`double(2) == 4`, nil)
+	assert.Error(t, err)
+
+	assert.NoError(t, RegisterFunc("triple", func(i int) (int, error) {
+		if i < 0 {
+			return 0, errors.New("negative")
+		}
+		return i * 3, nil
+	}))
+	assert.True(t, MustExecute(`triple(2) == 6`, nil))
+	_, err = Execute(`triple(-1) == 6`, nil)
+	assert.Error(t, err)
+
+	assert.Error(t, RegisterFunc("bad name", strings.ToLower))
+	assert.Error(t, RegisterFunc("bad", 1))
+	assert.Error(t, RegisterFunc("bad", func() {}))
+	assert.Error(t, RegisterFunc("bad", func(m map[string]string) bool { return true }))
+}
+
+func TestAssert_ExecuteConcurrent(t *testing.T) {
+	expr, err := New(`value > 100 && lower(name) == "web"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			result, err := expr.Execute(NewKV(map[string]interface{}{
+				"value": i * 10,
+				"name":  "WEB",
+			}))
+			assert.NoError(t, err)
+			assert.Equal(t, i*10 > 100, result)
+		}(i)
+	}
+	wait.Wait()
+}
+
+func TestNew_SyntaxError(t *testing.T) {
+	for _, code := range []string{
+		`a ==`,
+		`(a == 1`,
+		`a == 1)`,
+		`len(a,)`,
+	} {
+		_, err := New(code)
+		assert.Error(t, err, code)
+	}
+}
+
+const benchmarkRule = `code >= 200 && code < 300 && rt < 10000 && (host = "*.50.50" || lower(service) == "web")`
+
+var benchmarkData = map[string]interface{}{
+	"code":    200,
+	"rt":      56,
+	"host":    "172.16.50.50",
+	"service": "WEB",
+}
+
+// BenchmarkAssert_Parse 每次执行都重新编译表达式, 作为对比基准
+func BenchmarkAssert_Parse(b *testing.B) {
+	kv := NewKV(benchmarkData)
+	for i := 0; i < b.N; i++ {
+		if _, err := Execute(benchmarkRule, kv); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAssert_Execute(b *testing.B) {
+	expr, err := New(benchmarkRule)
+	if err != nil {
+		b.Fatal(err)
+	}
+	kv := NewKV(benchmarkData)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := expr.Execute(kv); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAssert_ExecuteParallel(b *testing.B) {
+	expr, err := New(benchmarkRule)
+	if err != nil {
+		b.Fatal(err)
+	}
+	kv := NewKV(benchmarkData)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := expr.Execute(kv); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestAssert_ExecuteIn(t *testing.T) {
+	kv := NewKV(map[string]interface{}{
+		"status": 502,
+		"env":    "prod",
+		"tags":   []string{"web", "api"},
+		"codes":  []interface{}{200, "201"},
+		"ports":  []int{80, 443},
+		"empty":  []string{},
+	})
+	for code, expect := range map[string]bool{
+		`status in [500, 502, 503, 504]`:     true,
+		`status not in [500, 502, 503, 504]`: false,
+		`status in [200, "x"]`:               false,
+		`env in ["prod", "staging"]`:         true,
+		`env not in ["prod", "staging"]`:     false,
+		`"web" in tags`:                      true,
+		`"db" not in tags`:                   true,
+		`201 in codes && 200 in codes`:       true,
+		`443 in ports`:                       true,
+		`"x" in empty`:                       false,
+		`"ro" in env`:                        true,
+		`missing in tags`:                    false,
+		`1 in missing`:                       false,
+		`len(tags) == 2 && len([]) == 0`:     true,
+		`[1, 2] == [1, 2]`:                   true,
+		`!(status in [1, 2]) && tags`:        true,
+	} {
+		result, err := Execute(code, kv)
+		if assert.NoError(t, err, code) {
+			assert.Equal(t, expect, result, code)
+		}
+	}
+
+	_, err := Execute(`1 in 1`, kv)
+	assert.Error(t, err)
+	_, err = Execute(`tags > 1`, kv)
+	assert.Error(t, err)
+	_, err = New(`status in [1, 2`)
+	assert.Error(t, err)
+
+	items, err := parse(`a not in [1,2]`)
+	assert.NoError(t, err)
+	assert.Equal(t, NOTIN, items[1].t)
+}
+
+func TestAssert_ExecuteNested(t *testing.T) {
+	type Item struct {
+		Name  string `json:"name"`
+		Count int
+	}
+	type Request struct {
+		Method string `json:"method"`
+		Items  []Item
+		Owner  *Item
+	}
+	kv := NewKV(map[string]interface{}{
+		"req": map[string]interface{}{
+			"headers": map[string]string{"host": "web.example.com"},
+			"tags":    map[string]interface{}{"env": "prod"},
+			"codes":   []int{200, 301},
+		},
+		"items": []interface{}{"a", map[string]interface{}{"name": "b"}},
+		"obj": &Request{
+			Method: "GET",
+			Items:  []Item{{Name: "x", Count: 3}},
+		},
+		"flat.key": 1,
+		"ids":      map[int]string{7: "seven"},
+		"any":      map[interface{}]interface{}{"k": "v"},
+		"structs":  map[struct{ A int }]int{{A: 1}: 1},
+		"ptrs":     map[*int]int{new(int): 1},
+		"errs":     map[error]int{nil: 1},
+		"bools":    map[bool]string{true: "yes"},
+	})
+	for code, expect := range map[string]bool{
+		`req.headers.host == "web.example.com"`:       true,
+		`req.tags["env"] == "prod"`:                   true,
+		`req["tags"].env == "prod"`:                   true,
+		`req.codes[1] == 301`:                         true,
+		`301 in req.codes`:                            true,
+		`items[0] == "a" && items[1].name == "b"`:     true,
+		`items[1]["name"] == "b"`:                     true,
+		`obj.method == "GET" && obj.Method == "GET"`:  true,
+		`obj.Items[0].name == "x"`:                    true,
+		`obj.Items[0].Count + 1 == 4`:                 true,
+		`obj.Owner == nil && obj.Owner.name == nil`:   true,
+		`req.headers.missing == nil`:                  true,
+		`req.tags["missing"] == nil`:                  true,
+		`items[5] == nil && items[-1] == nil`:         true,
+		`missing.a.b == nil && missing[0] == nil`:     true,
+		`flat.key == 1`:                               true,
+		`ids[7] == "seven"`:                           true,
+		`lower(req.headers.host)[0] == nil`:           true,
+		`-req.codes[0] < 0 && !req.tags.env == false`: true,
+		`any["k"] == "v" && any[[1, 2]] == nil`:       true,
+		`items[1.7] == nil && items[1.0].name == "b"`: true,
+		`ids[7.5] == nil`:                             true,
+		`structs[1] == nil && structs["A"] == nil`:    true,
+		`ptrs[1] == nil && ptrs[0] == nil`:            true,
+		`errs["x"] == nil && errs[1] == nil`:          true,
+		`bools[true] == "yes" && bools[1] == nil`:     true,
+	} {
+		result, err := Execute(code, kv)
+		if assert.NoError(t, err, code) {
+			assert.Equal(t, expect, result, code)
+		}
+	}
+
+	_, err := Execute(`req.headers.missing > 1`, kv)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "req.headers.missing")
+	}
+}
+
+func TestAssert_Variables(t *testing.T) {
+	expr, err := New(`a > 1 && (b.c == "x" || lower(d) in [e, a]) && items[0].name == f["k"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"a", "b.c", "d", "e", "items", "f"}, expr.Variables())
+
+	expr, _ = New(`1 == 1`)
+	assert.Empty(t, expr.Variables())
+}
+
+func TestAssert_Validate(t *testing.T) {
+	schema := map[string]Kind{
+		"code": Number,
+		"host": String,
+		"ok":   Boolean,
+		"tags": List,
+		"req":  Object,
+	}
+	for _, code := range []string{
+		`code > 200 && host =~ "^web" && ok`,
+		`code >= "200" && -code < 0`,
+		`host + code == "a1" && code + 1 > 2`,
+		`code in [200, 300] && "web" in tags && "a" in host`,
+		`req.headers.host == "x" && req["a"][0] > 1`,
+		`len(host) > 3 && lower(host) == "web" && min(code, 1) < 2`,
+		`tags[0] == "a" && code % 2 == 0`,
+	} {
+		expr, err := New(code)
+		if assert.NoError(t, err, code) {
+			assert.NoError(t, expr.Validate(schema), code)
+		}
+	}
+
+	for code, msg := range map[string]string{
+		`"abc" > 3`:                         "line 1, column 7",
+		`code > 1 && host > 3`:              "can not compare string value with number value",
+		`code =~ "200"`:                     "can not match regular expression on number value",
+		`code in 200`:                       "can not check membership in number value",
+		`missing == 1`:                      "unknown variable 'missing'",
+		`host.name == 1`:                    "unknown variable 'host.name'",
+		`unknown(code)`:                     "unknown function 'unknown'",
+		"code > 1 &&\n len(host, host) > 1": "line 2, column 2",
+		`-host < 1`:                         "can not negate string value",
+		`tags - 1 > 0`:                      "invalid operation between list value and number value",
+		`code.a == 1`:                       "unknown variable 'code.a'",
+		`code[0] == 1`:                      "can not index number value",
+	} {
+		expr, err := New(code)
+		if !assert.NoError(t, err, code) {
+			continue
+		}
+		err = expr.Validate(schema)
+		if assert.Error(t, err, code) {
+			assert.Contains(t, err.Error(), msg, code)
+			_, ok := err.(*TypeError)
+			assert.True(t, ok, code)
+		}
+	}
+}
+
+func TestNew_SyntaxErrorPosition(t *testing.T) {
+	_, err := New("a == 1 &&\n  b == ")
+	if assert.Error(t, err) {
+		e, ok := err.(*SyntaxError)
+		if assert.True(t, ok) {
+			assert.Equal(t, 2, e.Line)
+			t.Log(e)
+		}
+	}
+
+	_, err = New("a == 1 &&\n  b ==)")
+	if assert.Error(t, err) {
+		e, ok := err.(*SyntaxError)
+		if assert.True(t, ok) {
+			assert.Equal(t, Position{Offset: 16, Line: 2, Column: 7}, e.Position)
+		}
+	}
+
+	_, err = New(`  a | b`)
+	if assert.Error(t, err) {
+		e, ok := err.(*SyntaxError)
+		if assert.True(t, ok) {
+			assert.Equal(t, Position{Offset: 5, Line: 1, Column: 6}, e.Position)
+		}
+	}
+}
+
+func TestAssert_ExecuteExplain(t *testing.T) {
+	expr, err := New(`code >= 500 && (host = "*.50.50" || lower(env) == "prod")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, x, err := expr.ExecuteExplain(NewKV(map[string]interface{}{
+		"code": 502,
+		"host": "10.1.50.50",
+		"env":  "PROD",
+	}))
+	assert.NoError(t, err)
+	assert.True(t, result)
+	assert.Equal(t, `code >= 500 && (host = "*.50.50" || lower(env) == "prod")`, x.Root.Expr)
+	assert.Equal(t, 2, len(x.Root.Children))
+	or := x.Root.Children[1]
+	assert.Equal(t, `host = "*.50.50" || lower(env) == "prod"`, or.Expr)
+	assert.False(t, or.Children[0].Skipped)
+	assert.True(t, or.Children[1].Skipped)
+	assert.Equal(t, int64(502), x.Variables["code"].val)
+	_, ok := x.Variables["env"]
+	assert.False(t, ok) // 短路, 没有读取
+	t.Log("\n" + x.String())
+
+	b, err := x.JSON()
+	assert.NoError(t, err)
+	t.Log(string(b))
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, true, decoded["result"])
+	assert.Equal(t, "10.1.50.50", decoded["variables"].(map[string]interface{})["host"])
+
+	result, x, err = expr.ExecuteExplain(NewKV(map[string]interface{}{
+		"code": 200,
+	}))
+	assert.NoError(t, err)
+	assert.False(t, result)
+	assert.Equal(t, false, x.Root.Value.val)
+	assert.True(t, x.Root.Children[1].Skipped)
+	assert.Contains(t, x.String(), "code => 200\n")
+
+	expr, _ = New(`value > 1 || value == nil`)
+	_, x, err = expr.ExecuteExplain(NewKV(map[string]interface{}{}))
+	assert.Error(t, err)
+	assert.NotEmpty(t, x.Error)
+	assert.NotEmpty(t, x.Root.Children[0].Error)
+}
+
+func TestFormat(t *testing.T) {
+	for _, code := range []string{
+		`a == 1 && (b || c)`,
+		`(a + b) * c - d / (e % f)`,
+		`a - (b - c)`,
+		`!(a > 1) && -(b + 1) < 0`,
+		`items[0].name == "x" && lower(s) in [1, 'a"b', nil, true]`,
+		`a.b.c not in tags && s !~ "^x" && h = "*.a"`,
+	} {
+		expr, err := New(code)
+		if assert.NoError(t, err, code) {
+			assert.Equal(t, code, format(expr.root))
+		}
+	}
+}
+
+func TestAssert_Normalize(t *testing.T) {
+	for code, expect := range map[string]string{
+		`((a))`:                        `a`,
+		`a > 1 && b`:                   `a > 1 && b`,
+		`b && a > 1`:                   `a > 1 && b`,
+		`c || (b || a)`:                `a || b || c`,
+		`a && a && b`:                  `a && b`,
+		`1 + 2 * 3 < x`:                `x > 7`,
+		`"b" == x`:                     `x == "b"`,
+		`!(x == 1) && !(y in [1, 2])`:  `x != 1 && y not in [1, 2]`,
+		`true && x`:                    `x`,
+		`false && x`:                   `false`,
+		`x || true`:                    `true`,
+		`(x - 1) - (2 - 1)`:            `x - 1 - 1`,
+		`-1 > x`:                       `x < -1`,
+		`lower(b + "x") == lower("A")`: `lower("A") == lower(b + "x")`,
+		`x / 0 > 1`:                    `x / 0 > 1`,
+		`1 / 0 > x`:                    `x < 1 / 0`,
+		`[1 + 1, "a"][0] == x`:         `x == 2`,
+		"a == 1 &&\n\t(b = 'x*' || c)": `a == 1 && (b = "x*" || c)`,
+	} {
+		expr, err := New(code)
+		if !assert.NoError(t, err, code) {
+			continue
+		}
+		n := expr.Normalize()
+		assert.Equal(t, expect, n.String(), code)
+		// 规范化是幂等的
+		assert.Equal(t, expect, n.Normalize().String(), code)
+	}
+
+	expr, _ := New(`b && a > 1`)
+	n := expr.Normalize()
+	for _, data := range []map[string]interface{}{
+		{"a": 2, "b": true},
+		{"a": 0, "b": true},
+		{"a": 2, "b": false},
+	} {
+		r1, err1 := expr.Execute(NewKV(data))
+		r2, err2 := n.Execute(NewKV(data))
+		assert.Equal(t, r1, r2)
+		assert.Equal(t, err1, err2)
+	}
+
+	// 短路的顺序变化后, 出错的结果可能不同
+	expr, _ = New(`b == 1 && a > 1`)
+	n = expr.Normalize()
+	assert.Equal(t, `a > 1 && b == 1`, n.String())
+	kv := NewKV(map[string]interface{}{"b": 2})
+	ok, err := expr.Execute(kv)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	_, err = n.Execute(kv)
+	assert.Error(t, err)
+}
+
+func TestAssert_ExecuteTime(t *testing.T) {
+	now := time.Now()
+	kv := NewKV(map[string]interface{}{
+		"last_seen": now.Add(-10 * time.Minute),
+		"fresh":     now.Add(-time.Minute),
+		"ts":        time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		"latency":   1500 * time.Millisecond,
+		"started":   "2026-01-01T00:00:00Z",
+		"unix":      now.Add(-10 * time.Minute).Unix(),
+		"stamp":     "2026-03-01T00:00:00Z",
+	})
+	for code, expect := range map[string]bool{
+		`last_seen < now() - 5m`:                       true,
+		`fresh < now() - 5m`:                           false,
+		`ts >= "2026-01-01T00:00:00Z"`:                 true,
+		`ts < "2026-01-01T00:00:00+08:00"`:             false,
+		`ts == "2026-03-01T08:00:00+08:00"`:            true,
+		`ts != "not a time"`:                           true,
+		`ts - 1h30m == "2026-02-28T22:30:00Z"`:         true,
+		`1h + ts == "2026-03-01T01:00:00Z"`:            true,
+		`ts - started > 24h * 31`:                      true,
+		`ts - started == 1416h`:                        true,
+		`latency > 1s && latency <= 1.5s`:              true,
+		`latency * 2 == 3s && 2 * latency == 3s`:       true,
+		`latency / 3 == 500ms && latency / 500ms == 3`: true,
+		`latency + 500ms == "2s" && -latency < 0s`:     true,
+		`1h30m == 90m && 1m > 59s && 100us < 1ms`:      true,
+		`ts in ["2026-03-01T00:00:00Z", "x"]`:          true,
+		`now() - unix > 300 && unix - now() < -300`:    true,
+		`now() > unix && ts > 1`:                       true,
+		`stamp >= "2026-01-01T00:00:00Z"`:              true,
+		`stamp < started`:                              false,
+	} {
+		result, err := Execute(code, kv)
+		if assert.NoError(t, err, code) {
+			assert.Equal(t, expect, result, code)
+		}
+	}
+
+	for _, code := range []string{
+		`ts > "yesterday"`,
+		`stamp > "yesterday"`,
+		`ts + ts > ts`,
+		`latency > 1`,
+		`1x > 1`,
+	} {
+		_, err := Execute(code, kv)
+		assert.Error(t, err, code)
+	}
+
+	expr, _ := New(`1h + 30m > latency`)
+	assert.Equal(t, `latency < 1h30m0s`, expr.Normalize().String())
+
+	schema := map[string]Kind{"ts": Time, "latency": Duration, "n": Number}
+	for code, ok := range map[string]bool{
+		`ts < now() - 5m && latency > 1s`:  true,
+		`ts - ts > 1h && latency / 2 < 1s`: true,
+		`ts > "2026-01-01T00:00:00Z"`:      true,
+		`ts > n && ts - n > 300`:           true,
+		`latency + n > 1s`:                 false,
+		`ts + ts > ts`:                     false,
+	} {
+		expr, err := New(code)
+		if assert.NoError(t, err, code) {
+			assert.Equal(t, ok, expr.Validate(schema) == nil, code)
+		}
+	}
+}
+
+func TestAssert_Where(t *testing.T) {
+	for code, expect := range map[string][2]string{
+		`host == "web" && value > 10`: {
+			`"host" = 'web' AND "value" > 10`,
+			`"host" = 'web' AND "value" > 10`,
+		},
+		`(a == 1 || b != 'x') && !c`: {
+			`("a" = 1 OR "b" != 'x') AND "c" != true`,
+			`("a" = 1 OR "b" <> 'x') AND NOT ("c" = TRUE)`,
+		},
+		`status in [500, 502] && env not in ["dev"]`: {
+			`("status" = 500 OR "status" = 502) AND ("env" != 'dev')`,
+			`"status" IN (500, 502) AND "env" NOT IN ('dev')`,
+		},
+		`host = "web-*.a?"`: {
+			`"host" =~ /^web-.*\.a.$/`,
+			`"host" LIKE 'web-%.a_' ESCAPE '\'`,
+		},
+		`host = "web-**.a_b"`: {
+			`"host" =~ /^web-.*\.a_b$/`,
+			`"host" LIKE 'web-%.a\_b' ESCAPE '\'`,
+		},
+		`host imatch "Web-*" && path = "/api/[a-z]*/v?"`: {
+			`"host" =~ /(?i)^Web-.*$/ AND "path" =~ /^\/api\/[a-z].*\/v.$/`,
+			``,
+		},
+		`time > now() - 1h30m && (a + 1) * 2 <= 10`: {
+			`"time" > now() - 90m AND ("a" + 1) * 2 <= 10`,
+			`"time" > CURRENT_TIMESTAMP - INTERVAL '90' MINUTE AND ("a" + 1) * 2 <= 10`,
+		},
+		`region == nil || region != nil`: {
+			`"region" = '' OR "region" != ''`,
+			`"region" IS NULL OR "region" IS NOT NULL`,
+		},
+		`!(a == 1) && !(b < 2 || c =~ "x")`: {
+			`"a" != 1 AND "b" >= 2 AND "c" !~ /x/`,
+			``,
+		},
+		`a == 1 && !(b == 2 && (c > 3 || d in [1, 2])) && !!e`: {
+			`"a" = 1 AND ("b" != 2 OR "c" <= 3 AND ("d" != 1 AND "d" != 2)) AND "e" = true`,
+			`"a" = 1 AND NOT ("b" = 2 AND ("c" > 3 OR "d" IN (1, 2))) AND NOT (NOT ("e" = TRUE))`,
+		},
+		`!(host = "web-*") && !(region == nil)`: {
+			`"host" !~ /^web-.*$/ AND "region" != ''`,
+			`NOT ("host" LIKE 'web-%' ESCAPE '\') AND NOT ("region" IS NULL)`,
+		},
+		`- -a > 1 && -(-a) > 1 && -(a - 1) < 0 && -2 < a`: {
+			`-(-"a") > 1 AND -(-"a") > 1 AND -("a" - 1) < 0 AND -2 < "a"`,
+			`-(-"a") > 1 AND -(-"a") > 1 AND -("a" - 1) < 0 AND -2 < "a"`,
+		},
+		`a + "x" == "yx" && "p-" + b + "-" + c != "p"`: {
+			``,
+			`"a" || 'x' = 'yx' AND 'p-' || "b" || '-' || "c" <> 'p'`,
+		},
+		`a + "1" > 2`: {
+			`"a" + '1' > 2`,
+			`"a" + '1' > 2`,
+		},
+		`req.host == "it's" && x in []`: {
+			`"req.host" = 'it\'s' AND 1 = 0`,
+			`"req"."host" = 'it''s' AND 1 = 0`,
+		},
+	} {
+		expr, err := New(code)
+		if !assert.NoError(t, err, code) {
+			continue
+		}
+		s, err := expr.InfluxQL()
+		if expect[0] == "" {
+			assert.Error(t, err, code)
+		} else if assert.NoError(t, err, code) {
+			assert.Equal(t, expect[0], s, code)
+		}
+		s, err = expr.SQL()
+		if expect[1] == "" {
+			assert.Error(t, err, code)
+		} else if assert.NoError(t, err, code) {
+			assert.Equal(t, expect[1], s, code)
+		}
+	}
+
+	expr, _ := New(`path =~ "^/api/v1" && path !~ "\.png$"`)
+	s, err := expr.InfluxQL()
+	assert.NoError(t, err)
+	assert.Equal(t, `"path" =~ /^\/api\/v1/ AND "path" !~ /\.png$/`, s)
+	_, err = expr.SQL()
+	assert.Error(t, err)
+
+	for _, code := range []string{
+		`lower(host) == "web"`,
+		`a =~ b`,
+		`a in b`,
+		`a in [b]`,
+		`items[0] == 1`,
+		`a == [1, 2]`,
+		`true && a`,
+		`!(a ?? b)`,
+		`!lower(a)`,
+		`a == 1 && !(b + 1)`,
+		`!(ip in_cidr "10.0.0.0/8")`,
+	} {
+		expr, err := New(code)
+		if !assert.NoError(t, err, code) {
+			continue
+		}
+		_, err = expr.InfluxQL()
+		if assert.Error(t, err, code) {
+			_, ok := err.(*PushdownError)
+			assert.True(t, ok, code)
+			t.Log(err)
+		}
+	}
+}
+
+func TestAssert_Evaluate(t *testing.T) {
+	kv := NewKV(map[string]interface{}{
+		"code":  503,
+		"host":  "web-1",
+		"ok":    true,
+		"empty": "",
+		"tags":  []string{"a", "b"},
+		"req":   map[string]interface{}{"path": "/api"},
+		"num":   "42",
+	})
+	for code, expect := range map[string]interface{}{
+		`code >= 500 ? "error" : "ok"`: "error",
+		`num + 1`:                      int64(43),
+		`num - 1`:                      int64(41),
+		`1 + "2"`:                      int64(3),
+		`num + "x"`:                    "42x",
+		`"v" + num`:                    "v42",
+		`code >= 500 ? code >= 503 ? "5xx+" : "5xx" : "ok"`: "5xx+",
+		`code < 500 ? "ok" : code < 503 ? "5xx" : "5xx+"`:   "5xx+",
+		`region ?? "default"`:                               "default",
+		`region ?? zone ?? host`:                            "web-1",
+		`empty ?? "default"`:                                "",
+		`req.method ?? "GET"`:                               "GET",
+		`host + ":" + code`:                                 "web-1:503",
+		`"ok=" + ok`:                                        "ok=true",
+		`"x" + 1.5 + 2`:                                     "x1.52",
+		`1.5 + 2 + "x"`:                                     "3.5x",
+		`(region ?? "cn") + "-" + (ok ? "up" : "down")`:     "cn-up",
+		`code + 1`:                                          int64(504),
+		`tags[0] ?? "none"`:                                 "a",
+		`ok ? tags : []`:                                    []interface{}{"a", "b"},
+	} {
+		expr, err := New(code)
+		if !assert.NoError(t, err, code) {
+			continue
+		}
+		v, err := expr.Evaluate(kv)
+		if assert.NoError(t, err, code) {
+			assert.Equal(t, expect, v.Interface(), code)
+		}
+	}
+
+	for code, msg := range map[string]string{
+		`host + region`:       "can not concatenate nil value with string",
+		`"a" + tags`:          "variable 'tags' is list, can not concatenate with string",
+		`ok ? host > 1 : "x"`: "",
+	} {
+		expr, err := New(code)
+		if !assert.NoError(t, err, code) {
+			continue
+		}
+		_, err = expr.Evaluate(kv)
+		if assert.Error(t, err, code) && msg != "" {
+			assert.Equal(t, msg, err.Error(), code)
+		}
+	}
+
+	// 没有选中的分支和短路的 ?? 不会执行
+	expr, _ := New(`ok ? "up" : host > 1`)
+	v, err := expr.Evaluate(kv)
+	assert.NoError(t, err)
+	assert.Equal(t, "up", v.String())
+
+	_, x, err := expr.ExecuteExplain(kv)
+	assert.NoError(t, err)
+	assert.Len(t, x.Root.Children, 3)
+	assert.True(t, x.Root.Children[2].Skipped)
+
+	expr, _ = New(`host ?? region`)
+	_, x, _ = expr.ExecuteExplain(kv)
+	assert.True(t, x.Root.Children[1].Skipped)
+	assert.NotContains(t, x.Variables, "region")
+
+	for code, expect := range map[string]string{
+		`a ? b : c ? d : e`:      `a ? b : c ? d : e`,
+		`(a ? b : c) ? d : e`:    `(a ? b : c) ? d : e`,
+		`a ?? b ?? c`:            `a ?? b ?? c`,
+		`(a ?? b) ?? c`:          `(a ?? b) ?? c`,
+		`(a ?? b) == c`:          `(a ?? b) == c`,
+		`a || b ? c + 1 : d`:     `a || b ? c + 1 : d`,
+		`1 > 0 ? a : b`:          `a`,
+		`nil ?? a`:               `a`,
+		`"x" ?? a`:               `"x"`,
+		`"a" + "b" == x ? 1 : 2`: `x == "ab" ? 1 : 2`,
+	} {
+		expr, err := New(code)
+		if !assert.NoError(t, err, code) {
+			continue
+		}
+		assert.Equal(t, expect, expr.Normalize().String(), code)
+	}
+
+	expr, _ = New(`(region ?? "cn") == "cn" && (code >= 500 ? "error" : "ok") == "error"`)
+	s, err := expr.SQL()
+	assert.NoError(t, err)
+	assert.Equal(t, `(COALESCE("region", 'cn')) = 'cn' AND (CASE WHEN "code" >= 500 THEN 'error' ELSE 'ok' END) = 'error'`, s)
+	_, err = expr.InfluxQL()
+	assert.Error(t, err)
+
+	assert.NoError(t, expr.Validate(map[string]Kind{"region": String, "code": Number}))
+	expr, _ = New(`host + tags == "x"`)
+	assert.Error(t, expr.Validate(map[string]Kind{"host": String, "tags": List}))
+}
+
+func TestRuleSet(t *testing.T) {
+	rules, err := NewRuleSet(map[string]string{
+		"api-5xx":  `service == "api" && code >= 500`,
+		"api-slow": `"api" == service && latency > 1s`,
+		"web-5xx":  `service == "web" && code >= 500`,
+		"db":       `service in ["mysql", "redis"] && code != 0`,
+		"any-5xx":  `code >= 500`,
+		"teapot":   `code == 418`,
+		"host":     `lower(host) == "web-1" || code >= 500 && service == "web"`,
+		"bad-type": `service == "api" && host > 1`,
+		"missing":  `(region ?? "cn") == "cn" && service == "api"`,
+		"never":    `service == "none"`,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 10, rules.Len())
+
+	for _, c := range []struct {
+		kv      map[string]interface{}
+		matched []string
+		errors  []string
+	}{
+		{
+			kv:      map[string]interface{}{"service": "api", "code": 503, "latency": "2s", "host": "WEB-1"},
+			matched: []string{"any-5xx", "api-5xx", "api-slow", "host", "missing"},
+			errors:  []string{"bad-type"},
+		},
+		{
+			kv:      map[string]interface{}{"service": "web", "code": 502, "host": "web-2"},
+			matched: []string{"any-5xx", "host", "web-5xx"},
+		},
+		{
+			kv:      map[string]interface{}{"service": "redis", "code": 418},
+			matched: []string{"db", "teapot"},
+		},
+		{
+			kv: map[string]interface{}{"service": "mysql", "code": 0},
+		},
+	} {
+		matched, err := rules.Match(NewKV(c.kv))
+		assert.Equal(t, c.matched, matched, "%v", c.kv)
+		if len(c.errors) == 0 {
+			assert.NoError(t, err, "%v", c.kv)
+			continue
+		}
+		merr, ok := err.(*MatchError)
+		if assert.True(t, ok, "%v", c.kv) {
+			for _, id := range c.errors {
+				assert.Contains(t, merr.Errors, id)
+			}
+			assert.Len(t, merr.Errors, len(c.errors))
+		}
+	}
+
+	// 相同的子表达式和变量只保存一份
+	assert.Len(t, rules.index, 2)
+	code := rules.rules["api-5xx"].root.(*binaryNode).right
+	assert.True(t, code == rules.rules["web-5xx"].root.(*binaryNode).right)
+	assert.True(t, code == rules.rules["any-5xx"].root)
+
+	// 替换和删除规则
+	assert.NoError(t, rules.Add("never", `service == "mysql"`))
+	assert.True(t, rules.Remove("db"))
+	assert.False(t, rules.Remove("db"))
+	s, ok := rules.Get("never")
+	assert.True(t, ok)
+	assert.Equal(t, `service == "mysql"`, s)
+	matched, err := rules.Match(NewKV(map[string]interface{}{"service": "mysql", "code": 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"never"}, matched)
+	assert.Equal(t, 9, rules.Len())
+
+	assert.Error(t, rules.Add("broken", `code >`))
+	_, err = NewRuleSet(map[string]string{"broken": `code >`})
+	assert.Error(t, err)
+}
+
+func TestRuleSet_Concurrent(t *testing.T) {
+	rules, _ := NewRuleSet(map[string]string{
+		"a": `service == "a" && code > 1`,
+		"b": `code > 1`,
+	})
+	var wait sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wait.Add(2)
+		go func() {
+			defer wait.Done()
+			matched, err := rules.Match(NewKV(map[string]interface{}{"service": "a", "code": 2}))
+			assert.NoError(t, err)
+			assert.Contains(t, matched, "b")
+		}()
+		go func(i int) {
+			defer wait.Done()
+			assert.NoError(t, rules.Add(fmt.Sprintf("r%d", i), fmt.Sprintf(`service == "s%d"`, i)))
+		}(i)
+	}
+	wait.Wait()
+	assert.Equal(t, 22, rules.Len())
+}
+
+func benchmarkRules(n int) (map[string]string, KV) {
+	rules := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		rules[fmt.Sprintf("rule-%d", i)] = fmt.Sprintf(`service == "svc-%d" && code >= 500 && lower(host) != "localhost"`, i%100)
+	}
+	return rules, NewKV(map[string]interface{}{"service": "svc-7", "code": 502, "host": "web-1"})
+}
+
+func BenchmarkRuleSet_Match(b *testing.B) {
+	rules, kv := benchmarkRules(1000)
+	s, _ := NewRuleSet(rules)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Match(kv)
+	}
+}
+
+func BenchmarkRuleSet_ExecuteEach(b *testing.B) {
+	rules, kv := benchmarkRules(1000)
+	exprs := make([]*Assert, 0, len(rules))
+	for _, code := range rules {
+		expr, _ := New(code)
+		exprs = append(exprs, expr)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, expr := range exprs {
+			expr.Execute(kv)
+		}
+	}
+}
+
+func TestAssert_ExecuteGlob(t *testing.T) {
+	kv := NewKV(map[string]interface{}{
+		"host":      "Web-12.bj.example.com",
+		"path":      "/api/v1/users",
+		"client_ip": "10.1.2.3",
+		"ipv6":      "2001:db8::1",
+		"bad_ip":    "10.1.2",
+		"nets":      []string{"192.168.0.0/16", "10.0.0.0/8"},
+	})
+	for code, expect := range map[string]bool{
+		`host = "Web-*"`:                                      true,
+		`host = "web-*"`:                                      false,
+		`host imatch "web-*"`:                                 true,
+		`host imatch "WEB-[0-9][0-9].*.EXAMPLE.COM"`:          true,
+		`host = "Web-[!0-9]*"`:                                false,
+		`host = "Web-[^a-z]?.*"`:                              true,
+		`host = "Web-1[a-c].*"`:                               false,
+		`path = "/api/*"`:                                     true,
+		`path = "/api/**"`:                                    true,
+		`path = "/api/*/users"`:                               true,
+		`path = "/api/v?/*"`:                                  true,
+		`path = "*/users"`:                                    true,
+		`path = "/api?v1/users"`:                              true,
+		`pathMatch(path, "/api/*")`:                           false,
+		`pathMatch(path, "/api/**")`:                          true,
+		`pathMatch(path, "/api/*/users")`:                     true,
+		`pathMatch(path, "/api/v?/*")`:                        true,
+		`pathMatch(path, "/*/users")`:                         false,
+		`pathMatch(path, "**/users")`:                         true,
+		`pathMatch(path, "/api?v1/users")`:                    false,
+		`"a*b" = "a\*b" && "a-b" = "a[-]b" && "]" = "[]]"`:    true,
+		`client_ip in_cidr "10.0.0.0/8"`:                      true,
+		`client_ip in_cidr "10.1.2.3"`:                        true,
+		`client_ip in_cidr "192.168.0.0/16"`:                  false,
+		`client_ip not in_cidr "192.168.0.0/16"`:              true,
+		`client_ip in_cidr ["192.168.0.0/16", "10.1.0.0/16"]`: true,
+		`client_ip in_cidr nets`:                              true,
+		`ipv6 in_cidr "2001:db8::/32"`:                        true,
+		`ipv6 in_cidr "10.0.0.0/8"`:                           false,
+		`bad_ip in_cidr "10.0.0.0/8"`:                         false,
+		`missing in_cidr "10.0.0.0/8"`:                        false,
+		`!(client_ip not in_cidr "10.0.0.0/8")`:               true,
+	} {
+		expr, err := New(code)
+		if !assert.NoError(t, err, code) {
+			continue
+		}
+		ok, err := expr.Execute(kv)
+		if assert.NoError(t, err, code) {
+			assert.Equal(t, expect, ok, code)
+		}
+	}
+
+	for code, msg := range map[string]string{
+		`client_ip in_cidr "10.0.0/8"`: "invalid CIDR '10.0.0/8'",
+		`client_ip in_cidr 10`:         "can not check IP in number value, should be CIDR or list of CIDR",
+	} {
+		expr, err := New(code)
+		if !assert.NoError(t, err, code) {
+			continue
+		}
+		_, err = expr.Execute(kv)
+		if assert.Error(t, err, code) {
+			assert.Equal(t, msg, err.Error(), code)
+		}
+		assert.Error(t, expr.Validate(map[string]Kind{"host": String, "client_ip": String}), code)
+	}
+
+	expr, _ := New(`client_ip in_cidr "10.0.0.0/8" && !(host imatch "web-*")`)
+	assert.Equal(t, `client_ip in_cidr "10.0.0.0/8" && !(host imatch "web-*")`, expr.String())
+	assert.Equal(t, `!(host imatch "web-*") && client_ip in_cidr "10.0.0.0/8"`, expr.Normalize().String())
+	assert.True(t, Equal(`!(ip in_cidr "10.0.0.0/8")`, `ip not in_cidr "10.0.0.0/8"`))
+
+	expr, _ = New(`host imatch "Web-**"`)
+	s, err := expr.SQL()
+	assert.NoError(t, err)
+	assert.Equal(t, `LOWER("host") LIKE 'web-%' ESCAPE '\'`, s)
+	expr, _ = New(`client_ip in_cidr "10.0.0.0/8"`)
+	_, err = expr.InfluxQL()
+	assert.Error(t, err)
+}
+
+func TestRegexpCache(t *testing.T) {
+	defer SetRegexpCacheSize(DefaultRegexpCacheSize)
+	SetRegexpCacheSize(0)
+	SetRegexpCacheSize(2)
+	before := RegexpCacheStats()
+	assert.Equal(t, 0, before.Size)
+
+	// 常量的正则在 New 时编译, 不使用缓存
+	expr, _ := New(`host =~ "^web-\d+$" && host = "web-*" && host imatch "WEB-*"`)
+	ok, err := expr.Execute(NewKV(map[string]interface{}{"host": "web-1"}))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, before, RegexpCacheStats())
+
+	expr, _ = New(`host =~ pattern`)
+	for _, pattern := range []string{"^a", "^b", "^a", "^c", "^a"} {
+		ok, err := expr.Execute(NewKV(map[string]interface{}{"host": "abc", "pattern": pattern}))
+		assert.NoError(t, err)
+		assert.Equal(t, pattern == "^a", ok, pattern)
+	}
+	stats := RegexpCacheStats()
+	assert.Equal(t, 2, stats.Size)
+	assert.Equal(t, 2, stats.Capacity)
+	assert.Equal(t, before.Hits+2, stats.Hits)
+	assert.Equal(t, before.Misses+3, stats.Misses)
+	assert.Equal(t, before.Evictions+1, stats.Evictions) // ^b 最久没有使用
+
+	SetRegexpCacheSize(0)
+	assert.Equal(t, 0, RegexpCacheStats().Size)
+}
+
+func TestAssert_PatternError(t *testing.T) {
+	for code, msg := range map[string]string{
+		`host =~ "a(b"`:                 "syntax error at line 1, column 9: error parsing regexp: missing closing ): `a(b`",
+		"a == 1 &&\n  a !~ '('":         "syntax error at line 2, column 8: error parsing regexp: missing closing ): `(`",
+		`host = "web-[0-9"`:             "syntax error at line 1, column 8: invalid glob pattern 'web-[0-9': unclosed '['",
+		`ok ? 1 : host imatch "[a" > 0`: "syntax error at line 1, column 22: invalid glob pattern '[a': unclosed '['",
+	} {
+		_, err := New(code)
+		if assert.Error(t, err, code) {
+			assert.Equal(t, msg, err.Error(), code)
+			_, ok := err.(*SyntaxError)
+			assert.True(t, ok, code)
+		}
+	}
+}
+
+func TestRegexpLimits(t *testing.T) {
+	defer SetRegexpLimits(DefaultMaxRegexpLength, DefaultMaxRegexpProgram)
+	SetRegexpLimits(16, 100)
+
+	kv := NewKV(map[string]interface{}{
+		"host":    "web-1",
+		"long":    strings.Repeat("a", 17),
+		"complex": "(a|b){50}",
+	})
+	for code, msg := range map[string]string{
+		`host =~ long`:    "regular expression is too long: 17 bytes, the limit is 16",
+		`host !~ complex`: "regular expression is too complex",
+	} {
+		expr, err := New(code)
+		if !assert.NoError(t, err, code) {
+			continue
+		}
+		_, err = expr.Execute(kv)
+		if assert.Error(t, err, code) {
+			assert.Contains(t, err.Error(), msg, code)
+		}
+	}
+
+	for code, msg := range map[string]string{
+		`host =~ "^(web|db)-\d{1,50}"`: "syntax error at line 1, column 9: regular expression is too long",
+		`host =~ "[a-z]{200}"`:         "syntax error at line 1, column 9: regular expression is too complex",
+	} {
+		_, err := New(code)
+		if assert.Error(t, err, code) {
+			assert.Contains(t, err.Error(), msg, code)
+		}
+	}
+	expr, _ := New(`host =~ "^web"`)
+	ok, err := expr.Execute(kv)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+type testMeta struct {
+	Region string `json:"region"`
+	Zone   string
+}
+
+type testEvent struct {
+	*testMeta
+	Service string            `json:"service"`
+	Code    int               `json:"code,omitempty"`
+	Latency time.Duration     `json:"latency"`
+	Tags    map[string]string `json:"tags"`
+	Secret  string            `json:"-"`
+	Req     struct {
+		Path string `json:"path"`
+	} `json:"req"`
+	internal int
+}
+
+var testEventJSON = []byte(`{
+	"region": "bj", "Zone": "a",
+	"service": "api",
+	"code": 503,
+	"latency": "1.5s",
+	"tags": {"env": "prod", "a.b": [1, {"x": "y"}]},
+	"req": {"path": "/api/\"v1\""},
+	"ok": true, "nothing": null, "neg": -1.5e2,
+	"es\"caped": "yes",
+	"a.b": "flat"
+}`)
+
+func TestStructKV(t *testing.T) {
+	event := &testEvent{
+		testMeta: &testMeta{Region: "bj", Zone: "a"},
+		Service:  "api",
+		Code:     503,
+		Latency:  1500 * time.Millisecond,
+		Tags:     map[string]string{"env": "prod"},
+		Secret:   "x",
+	}
+	event.Req.Path = "/api"
+	for code, expect := range map[string]bool{
+		`service == "api" && Service == "api" && code >= 500`:     true,
+		`latency > 1s && tags.env == "prod" && req.path = "/api"`: true,
+		`region == "bj" && Zone == "a"`:                           true,
+		`Secret == nil && internal == nil && missing == nil`:      true,
+	} {
+		ok, err := Execute(code, StructKV(event))
+		if assert.NoError(t, err, code) {
+			assert.Equal(t, expect, ok, code)
+		}
+	}
+
+	// 嵌入的指针为 nil 时, 字段为 nil
+	ok, err := Execute(`region == nil && service == "web"`, StructKV(testEvent{Service: "web"}))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestJSONKV(t *testing.T) {
+	kv := JSONKV(testEventJSON)
+	for code, expect := range map[string]bool{
+		`service == "api" && code >= 500 && region == "bj"`: true,
+		`latency == 1500ms && ok && nothing == nil`:         true,
+		`tags.env == "prod" && req.path == '/api/"v1"'`:     true,
+		`tags["a.b"][1].x == "y" && len(tags["a.b"]) == 2`:  true,
+		`a.b == "flat" && neg == -150`:                      true,
+		`missing == nil && tags.missing == nil`:             true,
+		`Zone == "a"`:                                       true,
+	} {
+		ok, err := Execute(code, kv)
+		if assert.NoError(t, err, code) {
+			assert.Equal(t, expect, ok, code)
+		}
+	}
+	assert.Equal(t, "yes", kv.Get(`es"caped`))
+	assert.Equal(t, map[string]interface{}{"path": `/api/"v1"`}, kv.Get("req"))
+
+	for _, data := range []string{``, `[]`, `{}`, `{"a"}`, `{"a": }`, `{"a": "x`, `{"b": 1 "a": 1}`, `{"b": [1, 2}`} {
+		assert.Nil(t, JSONKV([]byte(data)).Get("a"), data)
+	}
+}
+
+const benchmarkKVRule = `service == "api" && code >= 500 && tags.env == "prod"`
+
+func BenchmarkKV_NewKV(b *testing.B) {
+	expr, _ := New(benchmarkKVRule)
+	var data map[string]interface{}
+	json.Unmarshal(testEventJSON, &data)
+	for i := 0; i < b.N; i++ {
+		expr.Execute(NewKV(data))
+	}
+}
+
+func BenchmarkKV_StructKV(b *testing.B) {
+	expr, _ := New(benchmarkKVRule)
+	event := &testEvent{Service: "api", Code: 503, Tags: map[string]string{"env": "prod"}}
+	for i := 0; i < b.N; i++ {
+		expr.Execute(StructKV(event))
+	}
+}
+
+func BenchmarkKV_JSONKV(b *testing.B) {
+	expr, _ := New(benchmarkKVRule)
+	for i := 0; i < b.N; i++ {
+		expr.Execute(JSONKV(testEventJSON))
+	}
+}
+
+func BenchmarkKV_JSONUnmarshal(b *testing.B) {
+	expr, _ := New(benchmarkKVRule)
+	for i := 0; i < b.N; i++ {
+		var data map[string]interface{}
+		json.Unmarshal(testEventJSON, &data)
+		expr.Execute(NewKV(data))
+	}
+}
+
+func TestAssert_ExecuteNumeric(t *testing.T) {
+	kv := NewKV(map[string]interface{}{
+		"id":    int64(9007199254740993), // 2^53 + 1, float64 无法精确表示
+		"id2":   int64(9007199254740992),
+		"big":   uint64(18446744073709551615),
+		"neg":   int32(-5),
+		"small": uint8(3),
+		"f":     0.1,
+		"str":   "9007199254740993",
+		"zero":  0,
+	})
+	for code, expect := range map[string]bool{
+		`id != id2 && id > id2 && id == 9007199254740993`:                    true,
+		`id == str && str > id2`:                                             true,
+		`big > id && big == 18446744073709551615 && neg < big`:               true,
+		`big + neg == 18446744073709551610`:                                  true,
+		`big - 1 == 18446744073709551614 && small - 5 == -2`:                 true,
+		`id + 1 - 1 == id && id * 1 == id`:                                   true,
+		`7 / 2 == 3.5 && 6 / 3 == 2 && 7 % 3 == 1 && -7 % 3 == -1`:           true,
+		`7.5 % 2 == 1.5 && 5.5 % -2 == 1.5`:                                  true,
+		`f + 0.2 == 0.3 && 0.1 * 3 <= 0.3 && 0.3 >= f * 3`:                   true,
+		`neg * small == -15 && abs(neg) == 5 && abs(-1.5) == 1.5`:            true,
+		`min(id, id2, 9007199254740994) == id2 && max(neg, small, 2.5) == 3`: true,
+		`id > 9007199254740992.0 && 1.5 < small && neg < -4.5`:               true,
+		`big > 1e19 && big < 1e20 && id2 == 9007199254740992.0`:              true,
+	} {
+		expr, err := New(code)
+		if !assert.NoError(t, err, code) {
+			continue
+		}
+		ok, err := expr.Execute(kv)
+		if assert.NoError(t, err, code) {
+			assert.Equal(t, expect, ok, code)
+		}
+	}
+
+	for code, expect := range map[string]interface{}{
+		`id + 1`:    int64(9007199254740994),
+		`big - 5`:   uint64(18446744073709551610),
+		`small - 5`: int64(-2),
+		`6 / 3`:     int64(2),
+		`7 / 2`:     3.5,
+		`id * 1.0`:  9007199254740992.0,
+		`abs(neg)`:  int64(5),
+		`"x" + id`:  "x9007199254740993",
+		`max(1, 2)`: int64(2),
+		`1.5 + 1.5`: 3.0,
+	} {
+		expr, err := New(code)
+		if !assert.NoError(t, err, code) {
+			continue
+		}
+		v, err := expr.Evaluate(kv)
+		if assert.NoError(t, err, code) {
+			assert.Equal(t, expect, v.Interface(), code)
+		}
+	}
+
+	for code, msg := range map[string]string{
+		`1 / zero`:                 "division by zero",
+		`1.5 / 0`:                  "division by zero",
+		`id % zero`:                "division by zero",
+		`big + 1`:                  "integer overflow",
+		`9223372036854775807 * 2`:  "integer overflow",
+		`-9223372036854775807 - 2`: "integer overflow",
+	} {
+		expr, err := New(code)
+		if !assert.NoError(t, err, code) {
+			continue
+		}
+		_, err = expr.Evaluate(kv)
+		if assert.Error(t, err, code) {
+			assert.Equal(t, msg, err.Error(), code)
+		}
+	}
+
+	n, err := NewValue("", uint64(1)<<63).Int()
+	assert.Error(t, err)
+	n, err = NewValue("", "-42").Int()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-42), n)
+	u, err := NewValue("", 3.0).Uint()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), u)
+	_, err = NewValue("", -1).Uint()
+	assert.Error(t, err)
+
+	// 函数参数按目标类型精确转换
+	expr, _ := New(`echo(id) == id`)
+	assert.NoError(t, expr.RegisterFunc("echo", func(i int64) int64 { return i }))
+	ok, err := expr.Execute(kv)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	expr, _ = New(`byte(300)`)
+	assert.NoError(t, expr.RegisterFunc("byte", func(b uint8) uint8 { return b }))
+	_, err = expr.Execute(kv)
+	assert.Error(t, err)
+}
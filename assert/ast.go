@@ -0,0 +1,354 @@
+package assert
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// node 是编译后的语法树节点, 编译完成后不再修改, 所以可以被多个 goroutine 同时执行
+type node interface {
+	eval(e *evaluation) Value
+	position() pos
+}
+
+// pos 是节点在表达式中的字节偏移量, 二元运算等节点的位置是运算符的位置
+type pos int
+
+func (p pos) position() pos {
+	return p
+}
+
+// evaluation 保存一次执行过程中的上下文
+type evaluation struct {
+	kv    KV
+	funcs map[string]*function
+	trace *tracer        // 不为 nil 时记录每个子表达式的执行结果
+	memo  map[node]Value // 不为 nil 时缓存子表达式的结果, 用于 RuleSet 中共享的子表达式
+}
+
+// eval 执行子节点, 所有节点都通过它执行子节点, 以便记录执行过程
+func (e *evaluation) eval(n node) Value {
+	if e.trace != nil {
+		return e.trace.eval(e, n)
+	}
+	if e.memo != nil {
+		if _, ok := n.(*literalNode); !ok {
+			v, ok := e.memo[n]
+			if !ok {
+				v = n.eval(e)
+				e.memo[n] = v
+			}
+			return v
+		}
+	}
+	return n.eval(e)
+}
+
+func (e *evaluation) variable(name string) Value {
+	switch instance := e.kv.(type) {
+	case nil:
+		return nilValue
+	case pairs:
+		return instance.getValue(name)
+	default:
+		return NewValue(name, instance.Get(name))
+	}
+}
+
+func (e *evaluation) call(name string, args []Value) Value {
+	f, ok := e.funcs[name]
+	if !ok {
+		f = lookupFunc(name)
+	}
+	if f == nil {
+		return errorValue(errors.Errorf("unknown function '%s'", name))
+	}
+	return f.call(args)
+}
+
+// literalNode 是常量, 如 123, "abc", true, nil
+type literalNode struct {
+	pos
+	v  Value
+	re *regexp.Regexp // =~, !~, = 和 imatch 右边的常量在 New 时编译好的正则
+}
+
+func (n *literalNode) eval(e *evaluation) Value {
+	return n.v
+}
+
+// variableNode 是变量, 执行时从 KV 中取值.
+// 变量名中带 '.' 时, 如果 KV 中没有这个 key, 则按路径逐级访问, 如 req.headers.host
+type variableNode struct {
+	pos
+	name string
+	path []string
+}
+
+func newVariableNode(offset int, name string) *variableNode {
+	n := &variableNode{pos: pos(offset), name: name}
+	if strings.Contains(name, ".") {
+		n.path = strings.Split(name, ".")
+	}
+	return n
+}
+
+func (n *variableNode) eval(e *evaluation) Value {
+	v := e.variable(n.name)
+	if v.vType != Nil || n.path == nil {
+		return v
+	}
+	v = e.variable(n.path[0])
+	for _, field := range n.path[1:] {
+		v = v.Field(field)
+	}
+	v.name = n.name
+	return v
+}
+
+// unaryNode 是一元运算, 如 !a, -a
+type unaryNode struct {
+	pos
+	op int
+	x  node
+}
+
+func (n *unaryNode) eval(e *evaluation) Value {
+	v := e.eval(n.x)
+	switch n.op {
+	case NOT:
+		return v.Not()
+	case '-':
+		if v.vType == Duration {
+			return NewValue("", -v.val.(time.Duration))
+		}
+		return NewValue("", 0).Sub(v)
+	}
+	return errorValue(errors.Errorf("unknown unary operator %d", n.op))
+}
+
+// binaryNode 是二元运算, &&, || 和 ?? 会短路执行
+type binaryNode struct {
+	pos
+	op          int
+	left, right node
+}
+
+func (n *binaryNode) eval(e *evaluation) Value {
+	left := e.eval(n.left)
+	switch n.op {
+	case AND:
+		if left.vType == Error || !left.Boolean() {
+			return left
+		}
+		return e.eval(n.right)
+	case OR:
+		if left.vType == Error || left.Boolean() {
+			return left
+		}
+		return e.eval(n.right)
+	case COALESCE:
+		if left.vType != Nil {
+			return left
+		}
+		return e.eval(n.right)
+	case RE, NRE, MATCH, IMATCH:
+		if lit, ok := n.right.(*literalNode); ok && lit.re != nil {
+			e.eval(n.right)
+			return left.matchRegexp(lit.re, n.op == NRE)
+		}
+	}
+	return binary(n.op, left, e.eval(n.right))
+}
+
+func binary(op int, left, right Value) Value {
+	switch op {
+	case E:
+		return left.E(right)
+	case NE:
+		return left.NE(right)
+	case RE:
+		return left.RE(right)
+	case NRE:
+		return left.NRE(right)
+	case LT:
+		return left.LT(right)
+	case GT:
+		return left.GT(right)
+	case LTE:
+		return left.LTE(right)
+	case GTE:
+		return left.GTE(right)
+	case MATCH:
+		return left.MATCH(right)
+	case IMATCH:
+		return left.IMATCH(right)
+	case INCIDR:
+		return left.InCIDR(right)
+	case NOTINCIDR:
+		return left.NotInCIDR(right)
+	case IN:
+		return left.In(right)
+	case NOTIN:
+		return left.NotIn(right)
+	case '+':
+		return left.Add(right)
+	case '-':
+		return left.Sub(right)
+	case '*':
+		return left.Multi(right)
+	case '/':
+		return left.Div(right)
+	case '%':
+		return left.Mod(right)
+	}
+	return errorValue(errors.Errorf("unknown binary operator %d", op))
+}
+
+// ternaryNode 是条件运算 cond ? yes : no, 只执行选中的分支
+type ternaryNode struct {
+	pos
+	cond, yes, no node
+}
+
+func (n *ternaryNode) eval(e *evaluation) Value {
+	cond := e.eval(n.cond)
+	if cond.vType == Error {
+		return cond
+	}
+	if cond.Boolean() {
+		return e.eval(n.yes)
+	}
+	return e.eval(n.no)
+}
+
+// callNode 是函数调用, 函数在执行时才查找, 所以可以在 New 之后再注册
+type callNode struct {
+	pos
+	name string
+	args []node
+}
+
+func (n *callNode) eval(e *evaluation) Value {
+	args := make([]Value, len(n.args))
+	for i, arg := range n.args {
+		args[i] = e.eval(arg)
+	}
+	return e.call(n.name, args)
+}
+
+// listNode 是列表常量, 如 [500, 502, "x"]
+type listNode struct {
+	pos
+	items []node
+}
+
+func (n *listNode) eval(e *evaluation) Value {
+	items := make([]Value, len(n.items))
+	for i, item := range n.items {
+		items[i] = e.eval(item)
+		if items[i].vType == Error {
+			return items[i]
+		}
+	}
+	return Value{
+		val:   items,
+		vType: List,
+	}
+}
+
+// fieldNode 是对表达式结果的字段访问, 如 items[0].name
+type fieldNode struct {
+	pos
+	x    node
+	path []string
+}
+
+func newFieldNode(offset int, x node, raw string) *fieldNode {
+	return &fieldNode{pos: pos(offset), x: x, path: strings.Split(strings.TrimPrefix(raw, "."), ".")}
+}
+
+func (n *fieldNode) eval(e *evaluation) Value {
+	v := e.eval(n.x)
+	for _, field := range n.path {
+		v = v.Field(field)
+	}
+	return v
+}
+
+// indexNode 是下标访问, 如 tags["env"], items[0]
+type indexNode struct {
+	pos
+	x     node
+	index node
+}
+
+func (n *indexNode) eval(e *evaluation) Value {
+	return e.eval(n.x).Index(e.eval(n.index))
+}
+
+// precompile 编译正则和通配符的常量操作数, 编译失败或者超出限制时返回带有常量位置的 *SyntaxError
+func precompile(code string, root node) error {
+	var err error
+	walk(root, func(n node) bool {
+		b, ok := n.(*binaryNode)
+		if !ok || err != nil {
+			return err == nil
+		}
+		lit, ok := b.right.(*literalNode)
+		if !ok || lit.v.vType != String {
+			return true
+		}
+		pattern := lit.v.String()
+		switch b.op {
+		case RE, NRE:
+		case MATCH, IMATCH:
+			if pattern, err = globToRegexp(pattern, b.op == IMATCH, false); err != nil {
+				err = &SyntaxError{Position: position(code, int(lit.position())), Msg: err.Error()}
+				return false
+			}
+		default:
+			return true
+		}
+		if lit.re, err = precompileRegexp(pattern); err != nil {
+			err = &SyntaxError{Position: position(code, int(lit.position())), Msg: err.Error()}
+			return false
+		}
+		return true
+	})
+	return err
+}
+
+// walk 先序遍历语法树, fn 返回 false 时不再访问该节点的子节点
+func walk(n node, fn func(node) bool) {
+	if !fn(n) {
+		return
+	}
+	switch n := n.(type) {
+	case *unaryNode:
+		walk(n.x, fn)
+	case *binaryNode:
+		walk(n.left, fn)
+		walk(n.right, fn)
+	case *ternaryNode:
+		walk(n.cond, fn)
+		walk(n.yes, fn)
+		walk(n.no, fn)
+	case *callNode:
+		for _, arg := range n.args {
+			walk(arg, fn)
+		}
+	case *listNode:
+		for _, item := range n.items {
+			walk(item, fn)
+		}
+	case *fieldNode:
+		walk(n.x, fn)
+	case *indexNode:
+		walk(n.x, fn)
+		walk(n.index, fn)
+	}
+}
@@ -0,0 +1,131 @@
+package assert
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Explanation 解释一次执行的结果, 包括每个子表达式的值和从 KV 中读取的变量
+type Explanation struct {
+	Result    bool             `json:"result"`
+	Error     string           `json:"error,omitempty"`
+	Variables map[string]Value `json:"variables"`
+	Root      *Trace           `json:"root"`
+}
+
+// Trace 是一个子表达式的执行结果
+type Trace struct {
+	Expr     string   `json:"expr"`
+	Value    Value    `json:"value"`
+	Error    string   `json:"error,omitempty"`
+	Variable bool     `json:"variable,omitempty"` // 是否是从 KV 中读取的变量
+	Skipped  bool     `json:"skipped,omitempty"`  // 因为 &&, ||, ?? 短路或者 ?: 没有选中而没有执行
+	Children []*Trace `json:"children,omitempty"`
+}
+
+// ExecuteExplain 和 Execute 一样执行表达式, 同时返回执行过程的解释, 用于回答表达式为什么是 true 或 false
+func (l *Assert) ExecuteExplain(kv KV) (bool, *Explanation, error) {
+	e := evaluation{
+		kv:    kv,
+		trace: &tracer{vars: make(map[string]Value)},
+	}
+	e.funcs, _ = l.funcs.Load().(map[string]*function)
+	answer := e.eval(l.root)
+
+	x := &Explanation{
+		Variables: e.trace.vars,
+		Root:      e.trace.root,
+	}
+	if err := answer.Error(); err != nil {
+		x.Error = err.Error()
+		return false, x, err
+	}
+	x.Result = answer.Boolean()
+	return x.Result, x, nil
+}
+
+// String 以缩进的文本形式展示执行过程
+func (x *Explanation) String() string {
+	var b strings.Builder
+	if x.Error != "" {
+		b.WriteString("error: " + x.Error + "\n")
+	} else if x.Result {
+		b.WriteString("result: true\n")
+	} else {
+		b.WriteString("result: false\n")
+	}
+	x.Root.write(&b, 0)
+	return b.String()
+}
+
+// JSON 以 JSON 形式展示执行过程
+func (x *Explanation) JSON() ([]byte, error) {
+	return json.Marshal(x)
+}
+
+func (t *Trace) write(b *strings.Builder, depth int) {
+	b.WriteString(strings.Repeat("  ", depth))
+	b.WriteString(t.Expr)
+	switch {
+	case t.Skipped:
+		b.WriteString(" => (skipped)")
+	case t.Expr != formatValue(t.Value): // 常量不需要重复展示值
+		b.WriteString(" => " + formatValue(t.Value))
+	}
+	b.WriteString("\n")
+	for _, child := range t.Children {
+		child.write(b, depth+1)
+	}
+}
+
+// tracer 在执行过程中构造 Trace 树
+type tracer struct {
+	root  *Trace
+	stack []*Trace
+	vars  map[string]Value
+}
+
+func (t *tracer) eval(e *evaluation, n node) Value {
+	trace := &Trace{Expr: format(n)}
+	if len(t.stack) == 0 {
+		t.root = trace
+	} else {
+		parent := t.stack[len(t.stack)-1]
+		parent.Children = append(parent.Children, trace)
+	}
+
+	t.stack = append(t.stack, trace)
+	v := n.eval(e)
+	t.stack = t.stack[:len(t.stack)-1]
+
+	trace.Value = v
+	if err := v.Error(); err != nil {
+		trace.Error = err.Error()
+	}
+	switch n := n.(type) {
+	case *variableNode:
+		trace.Variable = true
+		t.vars[n.name] = v
+	case *binaryNode:
+		if (n.op == AND || n.op == OR || n.op == COALESCE) && len(trace.Children) == 1 {
+			trace.Children = append(trace.Children, skipped(n.right))
+		}
+	case *ternaryNode:
+		if len(trace.Children) == 2 {
+			if trace.Children[0].Value.Boolean() {
+				trace.Children = append(trace.Children, skipped(n.no))
+			} else {
+				trace.Children = []*Trace{trace.Children[0], skipped(n.yes), trace.Children[1]}
+			}
+		}
+	}
+	return v
+}
+
+func skipped(n node) *Trace {
+	return &Trace{
+		Expr:    format(n),
+		Value:   nilValue,
+		Skipped: true,
+	}
+}
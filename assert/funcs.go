@@ -0,0 +1,312 @@
+package assert
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Func 是一种原生的表达式函数, 参数个数和类型由函数自己检查
+type Func func(args ...Value) Value
+
+var (
+	valueType = reflect.TypeOf(Value{})
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+	globalFuncs = struct {
+		sync.RWMutex
+		m map[string]*function
+	}{m: make(map[string]*function)}
+)
+
+func init() {
+	for name, fn := range map[string]interface{}{
+		"len":       length,
+		"lower":     strings.ToLower,
+		"upper":     strings.ToUpper,
+		"contains":  strings.Contains,
+		"hasPrefix": strings.HasPrefix,
+		"hasSuffix": strings.HasSuffix,
+		"abs":       Func(absolute),
+		"min":       Func(minimum),
+		"max":       Func(maximum),
+		"round":     math.Round,
+		"now":       now,
+		"pathMatch": pathMatch,
+	} {
+		if err := RegisterFunc(name, fn); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// function 是注册后的函数, 原生的 Func 直接调用, 其他 Go 函数通过反射调用
+type function struct {
+	name   string
+	native Func
+	fn     reflect.Value
+}
+
+func newFunction(name string, fn interface{}) (*function, error) {
+	if !isFuncName(name) {
+		return nil, errors.Errorf("invalid function name '%s'", name)
+	}
+	switch f := fn.(type) {
+	case nil:
+		return nil, errors.Errorf("function '%s' is nil", name)
+	case Func:
+		return &function{name: name, native: f}, nil
+	case func(...Value) Value:
+		return &function{name: name, native: f}, nil
+	}
+
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return nil, errors.Errorf("value for '%s' is not a function", name)
+	}
+	t := v.Type()
+	switch {
+	case t.NumOut() == 1:
+	case t.NumOut() == 2 && t.Out(1) == errorType:
+	default:
+		return nil, errors.Errorf("function '%s' must return 1 value, or 1 value and an error", name)
+	}
+	for i := 0; i < t.NumIn(); i++ {
+		in := t.In(i)
+		if t.IsVariadic() && i == t.NumIn()-1 {
+			in = in.Elem()
+		}
+		if !isArgType(in) {
+			return nil, errors.Errorf("function '%s' has unsupported argument type %s", name, in)
+		}
+	}
+	return &function{name: name, fn: v}, nil
+}
+
+func isFuncName(name string) bool {
+	if name == "" || name == "true" || name == "false" || name == "nil" {
+		return false
+	}
+	for i, c := range name {
+		if unicode.IsLetter(c) || c == '_' || (i > 0 && (unicode.IsNumber(c) || c == '.')) {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func isArgType(t reflect.Type) bool {
+	if t == valueType || t == timeType || t == durationType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Interface,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// checkArity 检查参数个数, 原生的 Func 由函数自己检查
+func (f *function) checkArity(n int) error {
+	if f.native != nil {
+		return nil
+	}
+	t := f.fn.Type()
+	numIn := t.NumIn()
+	if t.IsVariadic() {
+		if n < numIn-1 {
+			return errors.Errorf("function '%s' expects at least %d argument(s), got %d", f.name, numIn-1, n)
+		}
+	} else if n != numIn {
+		return errors.Errorf("function '%s' expects %d argument(s), got %d", f.name, numIn, n)
+	}
+	return nil
+}
+
+// call 执行函数, 参数个数和类型错误都以 Error 类型的 Value 返回
+func (f *function) call(args []Value) Value {
+	for _, arg := range args {
+		if arg.vType == Error {
+			return arg
+		}
+	}
+	if f.native != nil {
+		return f.native(args...)
+	}
+
+	if err := f.checkArity(len(args)); err != nil {
+		return errorValue(err)
+	}
+	t := f.fn.Type()
+	numIn := t.NumIn()
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var argType reflect.Type
+		if t.IsVariadic() && i >= numIn-1 {
+			argType = t.In(numIn - 1).Elem()
+		} else {
+			argType = t.In(i)
+		}
+		v, err := arg.convert(argType)
+		if err != nil {
+			return errorValue(errors.Wrapf(err, "function '%s' argument %d", f.name, i+1))
+		}
+		in[i] = v
+	}
+
+	out := f.fn.Call(in)
+	if len(out) == 2 && !out[1].IsNil() {
+		return errorValue(errors.Wrapf(out[1].Interface().(error), "function '%s'", f.name))
+	}
+	if v, ok := out[0].Interface().(Value); ok {
+		return v
+	}
+	return NewValue("", out[0].Interface())
+}
+
+// convert 将 Value 转换为 Go 函数参数所需的类型
+func (v Value) convert(t reflect.Type) (reflect.Value, error) {
+	switch t {
+	case valueType:
+		return reflect.ValueOf(v), nil
+	case timeType:
+		tm, err := v.Time()
+		return reflect.ValueOf(tm), err
+	case durationType:
+		d, err := v.Duration()
+		return reflect.ValueOf(d), err
+	}
+	switch t.Kind() {
+	case reflect.Interface:
+		if v.val == nil {
+			return reflect.Zero(t), nil
+		}
+		return reflect.ValueOf(v.val), nil
+	case reflect.String:
+		return reflect.ValueOf(v.String()).Convert(t), nil
+	case reflect.Bool:
+		if v.vType != Boolean {
+			return reflect.Value{}, errors.Errorf("can not use %s value as boolean", v.vType)
+		}
+		return reflect.ValueOf(v.Boolean()).Convert(t), nil
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := v.Int()
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if reflect.Zero(t).OverflowInt(i) {
+			return reflect.Value{}, errors.Errorf("%d overflows %s", i, t)
+		}
+		return reflect.ValueOf(i).Convert(t), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := v.Uint()
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if reflect.Zero(t).OverflowUint(u) {
+			return reflect.Value{}, errors.Errorf("%d overflows %s", u, t)
+		}
+		return reflect.ValueOf(u).Convert(t), nil
+	}
+	f, err := v.Float()
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return reflect.ValueOf(f).Convert(t), nil
+}
+
+// RegisterFunc 注册一个全局函数, 所有表达式都可以调用.
+// fn 可以是 Func, 也可以是参数为 string, bool, 数字, interface{} 或 Value 的 Go 函数,
+// 返回 1 个值, 或者 1 个值加 1 个 error
+func RegisterFunc(name string, fn interface{}) error {
+	f, err := newFunction(name, fn)
+	if err != nil {
+		return err
+	}
+	globalFuncs.Lock()
+	globalFuncs.m[name] = f
+	globalFuncs.Unlock()
+	return nil
+}
+
+func lookupFunc(name string) *function {
+	globalFuncs.RLock()
+	defer globalFuncs.RUnlock()
+	return globalFuncs.m[name]
+}
+
+func length(v Value) int {
+	if v.vType == List {
+		return len(v.val.([]Value))
+	}
+	return utf8.RuneCountInString(v.String())
+}
+
+func now() time.Time {
+	return time.Now()
+}
+
+// absolute 计算绝对值, 整数的结果仍然是整数
+func absolute(args ...Value) Value {
+	if len(args) != 1 {
+		return errorValue(errors.Errorf("function 'abs' expects 1 argument(s), got %d", len(args)))
+	}
+	n, err := args[0].number()
+	if err != nil {
+		return errorValue(errors.Wrap(err, "function 'abs' argument 1"))
+	}
+	switch x := n.(type) {
+	case int64:
+		if x == math.MinInt64 {
+			return errorValue(errors.Wrap(errOverflow, "function 'abs'"))
+		}
+		if x < 0 {
+			x = -x
+		}
+		return NewValue("", x)
+	case uint64:
+		return NewValue("", x)
+	}
+	return NewValue("", math.Abs(n.(float64)))
+}
+
+func minimum(args ...Value) Value {
+	return extremum("min", args, func(c int) bool { return c < 0 })
+}
+
+func maximum(args ...Value) Value {
+	return extremum("max", args, func(c int) bool { return c > 0 })
+}
+
+// extremum 返回最小或最大的参数, 参数按数字精确比较, 返回值保持原来的类型
+func extremum(name string, args []Value, better func(c int) bool) Value {
+	if len(args) == 0 {
+		return errorValue(errors.Errorf("function '%s' expects at least 1 argument(s), got 0", name))
+	}
+	var res interface{}
+	for i, arg := range args {
+		n, err := arg.number()
+		if err != nil {
+			return errorValue(errors.Wrapf(err, "function '%s' argument %d", name, i+1))
+		}
+		if i == 0 {
+			res = n
+		} else if c, ok := compareNumbers(n, res); ok && better(c) {
+			res = n
+		}
+	}
+	return NewValue("", res)
+}
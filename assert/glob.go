@@ -0,0 +1,182 @@
+package assert
+
+import (
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// globToRegexp 将 = 使用的通配符转换成正则:
+//   - * 和 ** 匹配任意字符, ? 匹配一个字符
+//   - [abc] 匹配其中的一个字符, 支持 [a-z] 这样的范围, [!abc] 和 [^abc] 表示取反
+//   - \x 匹配字符 x 本身
+//
+// ignoreCase 为 true 时忽略大小写. segment 为 true 时按路径匹配, * 和 ? 不匹配 /, 只有 ** 可以跨越 /, 见 pathMatch
+func globToRegexp(pattern string, ignoreCase, segment bool) (string, error) {
+	var b strings.Builder
+	if ignoreCase {
+		b.WriteString("(?i)")
+	}
+	b.WriteString("^")
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch c := runes[i]; c {
+		case '*':
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else if segment {
+				b.WriteString("[^/]*")
+			} else {
+				b.WriteString(".*")
+			}
+		case '?':
+			if segment {
+				b.WriteString("[^/]")
+			} else {
+				b.WriteString(".")
+			}
+		case '[':
+			end := i + 1
+			if end < len(runes) && (runes[end] == '!' || runes[end] == '^') {
+				end++
+			}
+			if end < len(runes) && runes[end] == ']' { // []] 和 [!]] 中的 ] 是普通字符
+				end++
+			}
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			if end >= len(runes) {
+				return "", errors.Errorf("invalid glob pattern '%s': unclosed '['", pattern)
+			}
+			b.WriteString("[")
+			class := runes[i+1 : end]
+			if class[0] == '!' || class[0] == '^' {
+				b.WriteString("^")
+				class = class[1:]
+			}
+			for _, c := range class {
+				if c == '-' {
+					b.WriteRune(c)
+				} else {
+					b.WriteString(regexp.QuoteMeta(string(c)))
+				}
+			}
+			b.WriteString("]")
+			i = end
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+			}
+			b.WriteString(regexp.QuoteMeta(string(runes[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String(), nil
+}
+
+// globToLike 将通配符转换成 LIKE 的模式, 使用 \ 转义.
+// LIKE 不支持字符类, 包含 [ 时返回 false
+func globToLike(pattern string) (string, bool) {
+	var b strings.Builder
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch c := runes[i]; c {
+		case '*':
+			for i+1 < len(runes) && runes[i+1] == '*' {
+				i++
+			}
+			b.WriteString("%")
+		case '?':
+			b.WriteString("_")
+		case '[':
+			return "", false
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+			}
+			fallthrough
+		default:
+			switch c = runes[i]; c {
+			case '%', '_', '\\':
+				b.WriteString(`\` + string(c))
+			default:
+				b.WriteRune(c)
+			}
+		}
+	}
+	return b.String(), true
+}
+
+// matchGlob 检查 s 是否匹配通配符 pattern, 转换后的正则会被缓存
+func matchGlob(pattern, s string, ignoreCase, segment bool) (bool, error) {
+	expr, err := globToRegexp(pattern, ignoreCase, segment)
+	if err != nil {
+		return false, err
+	}
+	exp, err := compileRegexp(expr)
+	if err != nil {
+		return false, err
+	}
+	return exp.MatchString(s), nil
+}
+
+// pathMatch 是内置函数 pathMatch(s, pattern), 按路径匹配通配符: * 和 ? 不匹配 /, ** 匹配包括 / 在内的任意字符.
+// 例如 pathMatch(path, "/api/*/users") 匹配 /api/v1/users, 但不匹配 /api/v1/x/users
+func pathMatch(s, pattern string) (bool, error) {
+	return matchGlob(pattern, s, false, true)
+}
+
+// parseCIDR 解析网段, 单个 IP 地址当作只包含它自己的网段
+func parseCIDR(s string) (*net.IPNet, error) {
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, errors.Errorf("invalid CIDR '%s'", s)
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	}
+	return network, nil
+}
+
+// InCIDR 检查 IP 地址 v 是否在网段 v2 中, v2 可以是网段的列表; v 不是合法的 IP 地址时为 false
+func (v Value) InCIDR(v2 Value) Value {
+	if err := firstError(v, v2); err.vType == Error {
+		return err
+	}
+	var networks []Value
+	switch v2.vType {
+	case String:
+		networks = []Value{v2}
+	case List:
+		networks = v2.val.([]Value)
+	default:
+		return errorValue(errors.Errorf("can not check IP in %s value, should be CIDR or list of CIDR", v2.vType))
+	}
+
+	ip := net.ParseIP(v.String())
+	for _, item := range networks {
+		network, err := parseCIDR(item.String())
+		if err != nil {
+			return errorValue(err)
+		}
+		if ip != nil && network.Contains(ip) {
+			return trueValue
+		}
+	}
+	return falseValue
+}
+
+func (v Value) NotInCIDR(v2 Value) Value {
+	return v.InCIDR(v2).Not()
+}
@@ -0,0 +1,268 @@
+package assert
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// structFields 缓存结构体类型的字段, reflect.Type => map[string][]int
+var structFields sync.Map
+
+// fieldsOf 返回结构体类型中可以访问的字段, 键为 json 标签中的名字和字段名, 值为字段的下标.
+// 与 encoding/json 一样, 匿名嵌入的结构体的字段会被提升, 外层的字段优先
+func fieldsOf(t reflect.Type) map[string][]int {
+	if fields, ok := structFields.Load(t); ok {
+		return fields.(map[string][]int)
+	}
+	fields := make(map[string][]int)
+	var collect func(t reflect.Type, index []int, depth int)
+	collect = func(t reflect.Type, index []int, depth int) {
+		var embedded []reflect.StructField
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := strings.Split(field.Tag.Get("json"), ",")[0]
+			if tag == "-" {
+				continue
+			}
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if field.Anonymous && tag == "" && ft.Kind() == reflect.Struct {
+				embedded = append(embedded, field)
+				continue
+			}
+			if field.PkgPath != "" { // unexported
+				continue
+			}
+			idx := append(append([]int{}, index...), i)
+			for _, name := range []string{tag, field.Name} {
+				if _, ok := fields[name]; !ok && name != "" {
+					fields[name] = idx
+				}
+			}
+		}
+		if depth > 8 { // 防止嵌入的指针类型循环引用
+			return
+		}
+		for _, field := range embedded {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			collect(ft, append(append([]int{}, index...), field.Index[0]), depth+1)
+		}
+	}
+	collect(t, nil, 0)
+	structFields.Store(t, fields)
+	return fields
+}
+
+// fieldByIndex 和 reflect.Value.FieldByIndex 一样, 但是遇到 nil 的嵌入指针时返回 false 而不是 panic
+func fieldByIndex(rv reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 {
+			if rv = indirect(rv); !rv.IsValid() {
+				return rv, false
+			}
+		}
+		rv = rv.Field(x)
+	}
+	return rv, true
+}
+
+type structKV struct {
+	rv reflect.Value
+}
+
+// StructKV 将结构体或结构体指针包装成 KV, 变量名为字段 json 标签中的名字或字段名,
+// 嵌套的字段使用 a.b 访问. 与 NewKV 不同, 只有被读取的字段才会被转换
+func StructKV(v interface{}) KV {
+	return structKV{rv: indirect(reflect.ValueOf(v))}
+}
+
+// Get 实现 KV
+func (s structKV) Get(key string) interface{} {
+	v, _ := lookupField(s.rv, key)
+	return v
+}
+
+type jsonKV []byte
+
+// JSONKV 将 JSON 对象包装成 KV, 读取变量时才从原始数据中找到对应的值并解析, 不需要解析整个文档.
+// a.b 先查找名为 a.b 的字段, 找不到时再查找 a 中的字段 b; 数据不是合法的 JSON 时读取到的值为 nil
+func JSONKV(data []byte) KV {
+	return jsonKV(data)
+}
+
+// Get 实现 KV
+func (j jsonKV) Get(key string) interface{} {
+	raw, ok := jsonPath(j, key)
+	if !ok {
+		return nil
+	}
+	return decodeJSON(raw)
+}
+
+// jsonPath 查找对象中 key 对应的原始数据, key 中的 . 可以访问嵌套的对象
+func jsonPath(data []byte, key string) ([]byte, bool) {
+	if raw, ok := jsonField(data, key); ok {
+		return raw, true
+	}
+	for i := strings.IndexByte(key, '.'); i > 0; i = indexFrom(key, '.', i+1) {
+		if raw, ok := jsonField(data, key[:i]); ok {
+			if raw, ok := jsonPath(raw, key[i+1:]); ok {
+				return raw, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func indexFrom(s string, c byte, from int) int {
+	if i := strings.IndexByte(s[from:], c); i >= 0 {
+		return from + i
+	}
+	return -1
+}
+
+// jsonField 在 JSON 对象 data 中查找字段 key, 返回字段值的原始数据, 其他字段的值只会被跳过
+func jsonField(data []byte, key string) ([]byte, bool) {
+	i := skipSpace(data, 0)
+	if i >= len(data) || data[i] != '{' {
+		return nil, false
+	}
+	i = skipSpace(data, i+1)
+	if i < len(data) && data[i] == '}' {
+		return nil, false
+	}
+	for i < len(data) {
+		if data[i] != '"' {
+			return nil, false
+		}
+		end := skipString(data, i)
+		if end < 0 {
+			return nil, false
+		}
+		name := data[i+1 : end-1]
+		i = skipSpace(data, end)
+		if i >= len(data) || data[i] != ':' {
+			return nil, false
+		}
+		start := skipSpace(data, i+1)
+		end = skipValue(data, start)
+		if end < 0 {
+			return nil, false
+		}
+		if jsonKeyEqual(name, key) {
+			return data[start:end], true
+		}
+		i = skipSpace(data, end)
+		if i >= len(data) || data[i] != ',' {
+			return nil, false
+		}
+		i = skipSpace(data, i+1)
+	}
+	return nil, false
+}
+
+func jsonKeyEqual(raw []byte, key string) bool {
+	if bytes.IndexByte(raw, '\\') < 0 {
+		return string(raw) == key
+	}
+	var s string
+	if err := json.Unmarshal(append(append([]byte{'"'}, raw...), '"'), &s); err != nil {
+		return false
+	}
+	return s == key
+}
+
+func skipSpace(data []byte, i int) int {
+	for i < len(data) && (data[i] == ' ' || data[i] == '\t' || data[i] == '\n' || data[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// skipString 返回 data[i] 开始的字符串之后的位置, 格式错误时返回 -1
+func skipString(data []byte, i int) int {
+	for i++; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// skipValue 返回 data[i] 开始的值之后的位置, 格式错误时返回 -1
+func skipValue(data []byte, i int) int {
+	if i >= len(data) {
+		return -1
+	}
+	switch data[i] {
+	case '"':
+		return skipString(data, i)
+	case '{', '[':
+		depth := 0
+		for ; i < len(data); i++ {
+			switch data[i] {
+			case '"':
+				if i = skipString(data, i); i < 0 {
+					return -1
+				}
+				i--
+			case '{', '[':
+				depth++
+			case '}', ']':
+				if depth--; depth == 0 {
+					return i + 1
+				}
+			}
+		}
+		return -1
+	}
+	start := i
+	for i < len(data) && data[i] != ',' && data[i] != '}' && data[i] != ']' &&
+		data[i] != ' ' && data[i] != '\t' && data[i] != '\n' && data[i] != '\r' {
+		i++
+	}
+	if i == start {
+		return -1
+	}
+	return i
+}
+
+// decodeJSON 解析一个值, 整数解析为 int64 或 uint64, 对象和数组解析为 map[string]interface{} 和 []interface{}
+func decodeJSON(raw []byte) interface{} {
+	switch raw[0] {
+	case 'n':
+		return nil
+	case 't':
+		return string(raw) == "true"
+	case 'f':
+		return false
+	case '"':
+		if bytes.IndexByte(raw, '\\') < 0 {
+			return string(raw[1 : len(raw)-1])
+		}
+	default:
+		if raw[0] == '-' || raw[0] >= '0' && raw[0] <= '9' {
+			n, err := parseNumber(string(raw))
+			if err != nil {
+				return nil
+			}
+			return n
+		}
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil
+	}
+	return v
+}
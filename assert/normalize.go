@@ -0,0 +1,198 @@
+package assert
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Normalize 返回规范化后的表达式, String 返回规范的代码, 语义相同的表达式规范化后代码相同:
+//   - 去掉多余的括号和空白
+//   - 计算常量子表达式, 如 1 + 2 变成 3, true && a 变成 a
+//   - 可交换的运算按操作数排序, 如 b && a > 1 变成 a > 1 && b, 2 == a 变成 a == 2
+//   - 常量在左边的比较翻转到右边, 如 1 < a 变成 a > 1
+//   - 取反的比较变成相反的比较, 如 !(a == 1) 变成 a != 1
+//
+// 其中 && 和 || 只保证在没有出错时结果的真假不变. 操作数的执行顺序可能变化, 原来因为短路没有执行的操作数可能会被执行,
+// 所以出错的结果可能不同: 如 a 不存在时 b == 1 && a > 1 的结果是 false, 而规范化后的 a > 1 && b == 1 会返回错误
+func (l *Assert) Normalize() *Assert {
+	root := normalize(l.root)
+	code := format(root)
+	n, err := New(code)
+	if err != nil { // 打印的代码总是能重新编译, 以防万一保留规范化后的语法树
+		n = &Assert{code: code, root: root}
+	}
+	if funcs := l.funcs.Load(); funcs != nil {
+		n.funcs.Store(funcs)
+	}
+	return n
+}
+
+// inverse 是取反后等价的运算符
+var inverse = map[int]int{
+	E:         NE,
+	NE:        E,
+	RE:        NRE,
+	NRE:       RE,
+	IN:        NOTIN,
+	NOTIN:     IN,
+	INCIDR:    NOTINCIDR,
+	NOTINCIDR: INCIDR,
+}
+
+// flipped 是交换左右操作数后等价的运算符
+var flipped = map[int]int{
+	LT:  GT,
+	GT:  LT,
+	LTE: GTE,
+	GTE: LTE,
+}
+
+func normalize(n node) node {
+	switch n := n.(type) {
+	case *unaryNode:
+		x := normalize(n.x)
+		if b, ok := x.(*binaryNode); ok && n.op == NOT {
+			if op, ok := inverse[b.op]; ok {
+				return &binaryNode{pos: b.pos, op: op, left: b.left, right: b.right}
+			}
+		}
+		return fold(&unaryNode{pos: n.pos, op: n.op, x: x})
+	case *binaryNode:
+		return normalizeBinary(n)
+	case *ternaryNode:
+		cond := normalize(n.cond)
+		if lit, ok := cond.(*literalNode); ok {
+			if lit.v.Boolean() {
+				return normalize(n.yes)
+			}
+			return normalize(n.no)
+		}
+		return &ternaryNode{pos: n.pos, cond: cond, yes: normalize(n.yes), no: normalize(n.no)}
+	case *callNode:
+		args := make([]node, len(n.args))
+		for i, arg := range n.args {
+			args[i] = normalize(arg)
+		}
+		return &callNode{pos: n.pos, name: n.name, args: args}
+	case *listNode:
+		items := make([]node, len(n.items))
+		for i, item := range n.items {
+			items[i] = normalize(item)
+		}
+		return fold(&listNode{pos: n.pos, items: items})
+	case *fieldNode:
+		return fold(&fieldNode{pos: n.pos, x: normalize(n.x), path: n.path})
+	case *indexNode:
+		return fold(&indexNode{pos: n.pos, x: normalize(n.x), index: normalize(n.index)})
+	}
+	return n
+}
+
+func normalizeBinary(n *binaryNode) node {
+	left, right := normalize(n.left), normalize(n.right)
+	switch n.op {
+	case AND, OR:
+		var operands []node
+		for _, x := range []node{left, right} {
+			if lit, ok := x.(*literalNode); ok {
+				// true && a => a, false && a => false, true || a => true, false || a => a
+				if lit.v.Boolean() == (n.op == OR) {
+					return lit
+				}
+				continue
+			}
+			operands = append(operands, flatten(n.op, x)...)
+		}
+		if len(operands) == 0 {
+			return left
+		}
+		operands = sortNodes(operands, true)
+		res := operands[0]
+		for _, x := range operands[1:] {
+			res = &binaryNode{pos: n.pos, op: n.op, left: res, right: x}
+		}
+		return res
+	case COALESCE:
+		if lit, ok := left.(*literalNode); ok {
+			if lit.v.vType == Nil {
+				return right
+			}
+			return left
+		}
+	case E, NE, '*':
+		// 常量放在右边, 否则按代码排序
+		l, r := isConstant(left), isConstant(right)
+		if l && !r || l == r && format(left) > format(right) {
+			left, right = right, left
+		}
+	case LT, GT, LTE, GTE:
+		if isConstant(left) && !isConstant(right) {
+			return &binaryNode{pos: n.pos, op: flipped[n.op], left: right, right: left}
+		}
+	}
+	return fold(&binaryNode{pos: n.pos, op: n.op, left: left, right: right})
+}
+
+// flatten 展开同一种运算符连接的操作数, 如 a && (b && c) => [a, b, c]
+func flatten(op int, n node) []node {
+	if b, ok := n.(*binaryNode); ok && b.op == op {
+		return append(flatten(op, b.left), flatten(op, b.right)...)
+	}
+	return []node{n}
+}
+
+// sortNodes 按规范的代码排序, unique 为 true 时去掉重复的节点
+func sortNodes(nodes []node, unique bool) []node {
+	keys := make(map[node]string, len(nodes))
+	for _, n := range nodes {
+		keys[n] = format(n)
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return keys[nodes[i]] < keys[nodes[j]]
+	})
+	if !unique {
+		return nodes
+	}
+	res := make([]node, 0, len(nodes))
+	for i, n := range nodes {
+		if i == 0 || keys[n] != keys[nodes[i-1]] {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+// fold 在子节点全部是常量时直接计算出结果, 出错或者结果不能写成代码时保持原样
+func fold(n node) node {
+	if !isConstant(n) {
+		return n
+	}
+	v := n.eval(&evaluation{})
+	switch v.vType {
+	case Error, Object, Time: // 时间没有字面量
+		return n
+	case Duration:
+		if v.val.(time.Duration) < 0 {
+			return n
+		}
+	case Number:
+		if f, ok := v.val.(float64); ok && (math.IsInf(f, 0) || math.IsNaN(f)) || isNegative(v.val) {
+			return n
+		}
+	}
+	return &literalNode{pos: n.position(), v: v}
+}
+
+// isConstant 检查节点的值是否与 KV 无关, 函数调用的结果可能变化, 不算常量
+func isConstant(n node) bool {
+	constant := true
+	walk(n, func(x node) bool {
+		switch x.(type) {
+		case *variableNode, *callNode:
+			constant = false
+		}
+		return constant
+	})
+	return constant
+}
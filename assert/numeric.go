@@ -0,0 +1,416 @@
+package assert
+
+import (
+	"math"
+	"math/bits"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// 数字在 Value 中保存为 int64, uint64 或 float64 三种之一:
+//   - 有符号整数保存为 int64, 无符号整数保存为 uint64, 浮点数保存为 float64
+//   - 整数之间的运算和比较是精确的, 结果超出范围时返回错误; 只有和浮点数一起运算时才转换成浮点数
+//   - 浮点数按 15 位有效数字比较, 所以 0.1 + 0.2 == 0.3
+//   - 除以 0 返回错误, 而不是 Inf
+
+// floatDigits 是浮点数比较时的有效数字位数, float64 可以精确表示 15 位十进制有效数字
+const floatDigits = 15
+
+var (
+	errDivideByZero = errors.New("division by zero")
+	errOverflow     = errors.New("integer overflow")
+)
+
+// parseNumber 将文本解析为数字, 整数优先解析为 int64, 超出范围的正整数解析为 uint64
+func parseNumber(s string) (interface{}, error) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
+	}
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return u, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// number 将值转换成数字, 字符串会被解析, 返回值是 int64, uint64 或 float64
+func (v Value) number() (interface{}, error) {
+	switch v.vType {
+	case Number:
+		return v.val, nil
+	case String:
+		return parseNumber(v.val.(string))
+	}
+	_, err := v.Float()
+	return nil, err
+}
+
+// Int 将值转换为 int64, 浮点数必须是整数并且没有超出范围
+func (v Value) Int() (int64, error) {
+	n, err := v.number()
+	if err != nil {
+		return 0, err
+	}
+	switch n := n.(type) {
+	case int64:
+		return n, nil
+	case uint64:
+		if n > math.MaxInt64 {
+			return 0, errors.Errorf("%d overflows int64", n)
+		}
+		return int64(n), nil
+	}
+	f := n.(float64)
+	if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, errors.Errorf("%v can not be converted to int64 exactly", f)
+	}
+	return int64(f), nil
+}
+
+// Uint 将值转换为 uint64, 负数和小数会报错
+func (v Value) Uint() (uint64, error) {
+	n, err := v.number()
+	if err != nil {
+		return 0, err
+	}
+	switch n := n.(type) {
+	case int64:
+		if n < 0 {
+			return 0, errors.Errorf("%d overflows uint64", n)
+		}
+		return uint64(n), nil
+	case uint64:
+		return n, nil
+	}
+	f := n.(float64)
+	if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 {
+		return 0, errors.Errorf("%v can not be converted to uint64 exactly", f)
+	}
+	return uint64(f), nil
+}
+
+func toFloat(n interface{}) float64 {
+	switch n := n.(type) {
+	case int64:
+		return float64(n)
+	case uint64:
+		return float64(n)
+	}
+	return n.(float64)
+}
+
+// formatNumber 将数字写成十进制文本, 浮点数不使用科学计数法
+func formatNumber(n interface{}) string {
+	switch n := n.(type) {
+	case int64:
+		return strconv.FormatInt(n, 10)
+	case uint64:
+		return strconv.FormatUint(n, 10)
+	}
+	return strconv.FormatFloat(n.(float64), 'f', -1, 64)
+}
+
+// isNegative 检查数字是否小于 0
+func isNegative(n interface{}) bool {
+	switch n := n.(type) {
+	case int64:
+		return n < 0
+	case uint64:
+		return false
+	}
+	return n.(float64) < 0
+}
+
+// compareNumbers 比较两个数字, 返回 -1, 0, 1; 有 NaN 时返回 ok 为 false
+func compareNumbers(a, b interface{}) (c int, ok bool) {
+	switch x := a.(type) {
+	case int64:
+		switch y := b.(type) {
+		case int64:
+			return compareInt(x, y), true
+		case uint64:
+			if x < 0 {
+				return -1, true
+			}
+			return compareUint(uint64(x), y), true
+		}
+	case uint64:
+		switch y := b.(type) {
+		case int64:
+			if y < 0 {
+				return 1, true
+			}
+			return compareUint(x, uint64(y)), true
+		case uint64:
+			return compareUint(x, y), true
+		}
+	}
+	if f, ok := a.(float64); ok {
+		if math.IsNaN(f) {
+			return 0, false
+		}
+		if _, ok := b.(float64); !ok {
+			c, ok := compareNumbers(b, a)
+			return -c, ok
+		}
+	}
+	// a 是整数或浮点数, b 是浮点数
+	f := b.(float64)
+	if math.IsNaN(f) {
+		return 0, false
+	}
+	if af, ok := a.(float64); ok {
+		return compareFloat(af, f), true
+	}
+	// 整数与浮点数比较时, 超出 float64 精度的整数不能直接转换
+	switch {
+	case f < math.MinInt64:
+		return 1, true
+	case f >= math.MaxUint64:
+		return -1, true
+	case f != math.Trunc(f): // 小数的绝对值小于 2^52, 转换成浮点数比较不会改变大小关系
+		return compareFloat(toFloat(a), f), true
+	}
+	switch x := a.(type) {
+	case int64:
+		if f >= math.MaxInt64 {
+			return -1, true
+		}
+		return compareInt(x, int64(f)), true
+	case uint64:
+		if f < 0 {
+			return 1, true
+		}
+		return compareUint(x, uint64(f)), true
+	}
+	return 0, false
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareFloat 按 floatDigits 位有效数字比较浮点数, 消除二进制表示带来的误差
+func compareFloat(a, b float64) int {
+	if a == b {
+		return 0
+	}
+	if !math.IsInf(a, 0) && !math.IsInf(b, 0) &&
+		strconv.FormatFloat(a, 'g', floatDigits, 64) == strconv.FormatFloat(b, 'g', floatDigits, 64) {
+		return 0
+	}
+	if a < b {
+		return -1
+	}
+	return 1
+}
+
+// numericCompare 按数字比较 v 和 v2, ok 判断比较的结果
+func numericCompare(v, v2 Value, ok func(c int) bool) Value {
+	if err := firstError(v, v2); err.vType == Error {
+		return err
+	}
+	if isTemporal(v, v2) || isTimeStrings(v, v2) {
+		return temporalCompareValue(v, v2, ok)
+	}
+	a, err := v.number()
+	if err != nil {
+		return errorValue(err)
+	}
+	b, err := v2.number()
+	if err != nil {
+		return errorValue(err)
+	}
+	c, comparable := compareNumbers(a, b)
+	return Value{
+		val:   comparable && ok(c),
+		vType: Boolean,
+	}
+}
+
+// arith 计算 v op v2, 两个整数时按整数计算, 否则转换成浮点数计算
+func arith(op int, v, v2 Value) Value {
+	if err := firstError(v, v2); err.vType == Error {
+		return err
+	}
+	a, err := v.number()
+	if err != nil {
+		return errorValue(err)
+	}
+	b, err := v2.number()
+	if err != nil {
+		return errorValue(err)
+	}
+
+	var res interface{}
+	switch x := a.(type) {
+	case int64:
+		switch y := b.(type) {
+		case int64:
+			res, err = intArith(op, x, y)
+		case uint64:
+			res, err = mixedArith(op, x, y, false)
+		}
+	case uint64:
+		switch y := b.(type) {
+		case int64:
+			res, err = mixedArith(op, y, x, true)
+		case uint64:
+			res, err = uintArith(op, x, y)
+		}
+	}
+	if res == nil && err == nil {
+		res, err = floatArith(op, toFloat(a), toFloat(b))
+	}
+	if err != nil {
+		return errorValue(err)
+	}
+	return Value{
+		val:   res,
+		vType: Number,
+	}
+}
+
+func intArith(op int, a, b int64) (interface{}, error) {
+	switch op {
+	case '+':
+		c := a + b
+		if (c > a) != (b > 0) {
+			return nil, errOverflow
+		}
+		return c, nil
+	case '-':
+		c := a - b
+		if (c < a) != (b > 0) {
+			return nil, errOverflow
+		}
+		return c, nil
+	case '*':
+		if a == 0 || b == 0 {
+			return int64(0), nil
+		}
+		c := a * b
+		if c/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+			return nil, errOverflow
+		}
+		return c, nil
+	case '/':
+		if b == 0 {
+			return nil, errDivideByZero
+		}
+		if a%b != 0 { // 不能整除时按浮点数计算, 避免 1 / 2 == 0 这样的意外
+			return float64(a) / float64(b), nil
+		}
+		if a == math.MinInt64 && b == -1 {
+			return nil, errOverflow
+		}
+		return a / b, nil
+	case '%':
+		if b == 0 {
+			return nil, errDivideByZero
+		}
+		if b == -1 {
+			return int64(0), nil
+		}
+		return a % b, nil
+	}
+	return nil, errors.Errorf("unknown arithmetic operator %d", op)
+}
+
+func uintArith(op int, a, b uint64) (interface{}, error) {
+	switch op {
+	case '+':
+		c, carry := bits.Add64(a, b, 0)
+		if carry != 0 {
+			return nil, errOverflow
+		}
+		return c, nil
+	case '-':
+		if a >= b {
+			return a - b, nil
+		}
+		if b-a > 1<<63 {
+			return nil, errOverflow
+		}
+		return -int64(b-a-1) - 1, nil
+	case '*':
+		hi, lo := bits.Mul64(a, b)
+		if hi != 0 {
+			return nil, errOverflow
+		}
+		return lo, nil
+	case '/':
+		if b == 0 {
+			return nil, errDivideByZero
+		}
+		if a%b != 0 {
+			return float64(a) / float64(b), nil
+		}
+		return a / b, nil
+	case '%':
+		if b == 0 {
+			return nil, errDivideByZero
+		}
+		return a % b, nil
+	}
+	return nil, errors.Errorf("unknown arithmetic operator %d", op)
+}
+
+// mixedArith 计算 int64 和 uint64 之间的运算, swapped 为 true 时 u 在左边.
+// 两个数都能表示为 int64 或 uint64 时按整数计算, 否则返回 nil 按浮点数计算
+func mixedArith(op int, i int64, u uint64, swapped bool) (interface{}, error) {
+	if u <= math.MaxInt64 {
+		if swapped {
+			return intArith(op, int64(u), i)
+		}
+		return intArith(op, i, int64(u))
+	}
+	if i >= 0 {
+		if swapped {
+			return uintArith(op, u, uint64(i))
+		}
+		return uintArith(op, uint64(i), u)
+	}
+	if op == '+' { // 大于 MaxInt64 的 u 加上负数, 结果一定在 uint64 范围内
+		return u - uint64(-(i + 1)) - 1, nil
+	}
+	return nil, nil
+}
+
+func floatArith(op int, a, b float64) (interface{}, error) {
+	switch op {
+	case '+':
+		return a + b, nil
+	case '-':
+		return a - b, nil
+	case '*':
+		return a * b, nil
+	case '/':
+		if b == 0 {
+			return nil, errDivideByZero
+		}
+		return a / b, nil
+	case '%':
+		if b == 0 {
+			return nil, errDivideByZero
+		}
+		return math.Mod(a, b), nil
+	}
+	return nil, errors.Errorf("unknown arithmetic operator %d", op)
+}
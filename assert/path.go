@@ -0,0 +1,109 @@
+package assert
+
+import (
+	"reflect"
+)
+
+// Field 返回对象 v 的字段 name, v 可以是 map 或 struct, 找不到时返回 nil
+func (v Value) Field(name string) Value {
+	switch v.vType {
+	case Error:
+		return v
+	case Object:
+		if field, ok := lookupField(reflect.ValueOf(v.val), name); ok {
+			return NewValue("", field)
+		}
+	}
+	return nilValue
+}
+
+// Index 返回列表 v 的第 key 个元素, 或者对象 v 中 key 对应的字段, 找不到时返回 nil
+func (v Value) Index(key Value) Value {
+	if err := firstError(v, key); err.vType == Error {
+		return err
+	}
+	switch v.vType {
+	case List:
+		items := v.val.([]Value)
+		i, err := key.Int() // 小数不能作为下标
+		if err != nil {
+			return nilValue
+		}
+		if i < 0 || i >= int64(len(items)) {
+			return nilValue
+		}
+		return items[i]
+	case Object:
+		if field, ok := lookupIndex(reflect.ValueOf(v.val), key); ok {
+			return NewValue("", field)
+		}
+	}
+	return nilValue
+}
+
+func lookupField(rv reflect.Value, name string) (interface{}, bool) {
+	rv = indirect(rv)
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return lookupIndex(rv, NewValue("", name))
+		}
+		item := rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()))
+		if item.IsValid() {
+			return item.Interface(), true
+		}
+	case reflect.Struct:
+		if index, ok := fieldsOf(rv.Type())[name]; ok {
+			if field, ok := fieldByIndex(rv, index); ok {
+				return field.Interface(), true
+			}
+		}
+	}
+	return nil, false
+}
+
+func lookupIndex(rv reflect.Value, key Value) (interface{}, bool) {
+	rv = indirect(rv)
+	if rv.Kind() != reflect.Map {
+		return lookupField(rv, key.String())
+	}
+	kt := rv.Type().Key()
+	var k reflect.Value
+	switch kt.Kind() {
+	case reflect.String:
+		k = reflect.ValueOf(key.String()).Convert(kt)
+	case reflect.Interface:
+		if key.val == nil {
+			return nil, false
+		}
+		k = reflect.ValueOf(key.val)
+		// 列表等不能作为 map 的 key, 没有实现 key 的接口类型时也不能查找, MapIndex 会 panic
+		if !k.Type().Comparable() || !k.Type().AssignableTo(kt) {
+			return nil, false
+		}
+	default:
+		// 只有数字, 布尔值, 时间和时间段可以转换, 结构体和指针等类型的 key 无法用 Value 表示
+		if !isArgType(kt) || kt == valueType {
+			return nil, false
+		}
+		var err error
+		if k, err = key.convert(kt); err != nil {
+			return nil, false
+		}
+	}
+	item := rv.MapIndex(k)
+	if !item.IsValid() {
+		return nil, false
+	}
+	return item.Interface(), true
+}
+
+func indirect(rv reflect.Value) reflect.Value {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return reflect.Value{}
+		}
+		rv = rv.Elem()
+	}
+	return rv
+}
@@ -0,0 +1,177 @@
+package assert
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 运算符的优先级, 与 yacc.y 中的声明保持一致, 数字越大结合越紧
+const (
+	precTernary = iota + 1
+	precCoalesce
+	precOr
+	precAnd
+	precCompare
+	precAdd
+	precMulti
+	precUnary
+	precPostfix
+	precPrimary
+)
+
+var operators = map[int]string{
+	AND:       "&&",
+	OR:        "||",
+	NOT:       "!",
+	E:         "==",
+	NE:        "!=",
+	RE:        "=~",
+	NRE:       "!~",
+	LT:        "<",
+	GT:        ">",
+	LTE:       "<=",
+	GTE:       ">=",
+	MATCH:     "=",
+	IMATCH:    "imatch",
+	INCIDR:    "in_cidr",
+	NOTINCIDR: "not in_cidr",
+	IN:        "in",
+	NOTIN:     "not in",
+	COALESCE:  "??",
+	'+':       "+",
+	'-':       "-",
+	'*':       "*",
+	'/':       "/",
+	'%':       "%",
+}
+
+func precedence(n node) int {
+	switch n := n.(type) {
+	case *binaryNode:
+		switch n.op {
+		case OR:
+			return precOr
+		case AND:
+			return precAnd
+		case COALESCE:
+			return precCoalesce
+		case '+', '-':
+			return precAdd
+		case '*', '/', '%':
+			return precMulti
+		}
+		return precCompare
+	case *ternaryNode:
+		return precTernary
+	case *unaryNode:
+		return precUnary
+	case *fieldNode, *indexNode:
+		return precPostfix
+	}
+	return precPrimary
+}
+
+// format 将语法树转换回代码, 只在必要的地方加括号
+func format(n node) string {
+	var b strings.Builder
+	writeNode(&b, n)
+	return b.String()
+}
+
+func writeNode(b *strings.Builder, n node) {
+	switch n := n.(type) {
+	case *literalNode:
+		b.WriteString(formatValue(n.v))
+	case *variableNode:
+		b.WriteString(n.name)
+	case *unaryNode:
+		b.WriteString(operators[n.op])
+		writeOperand(b, n.x, precUnary)
+	case *binaryNode:
+		p := precedence(n)
+		if n.op == COALESCE { // 右结合, 左边同级的运算需要括号
+			writeOperand(b, n.left, p+1)
+			b.WriteString(" ?? ")
+			writeOperand(b, n.right, p)
+			break
+		}
+		writeOperand(b, n.left, p)
+		b.WriteString(" " + operators[n.op] + " ")
+		writeOperand(b, n.right, p+1) // 左结合, 右边同级的运算需要括号
+	case *ternaryNode:
+		writeOperand(b, n.cond, precTernary+1)
+		b.WriteString(" ? ")
+		writeNode(b, n.yes)
+		b.WriteString(" : ")
+		writeNode(b, n.no)
+	case *callNode:
+		b.WriteString(n.name + "(")
+		writeList(b, n.args)
+		b.WriteString(")")
+	case *listNode:
+		b.WriteString("[")
+		writeList(b, n.items)
+		b.WriteString("]")
+	case *fieldNode:
+		writeOperand(b, n.x, precPostfix)
+		b.WriteString("." + strings.Join(n.path, "."))
+	case *indexNode:
+		writeOperand(b, n.x, precPostfix)
+		b.WriteString("[")
+		writeNode(b, n.index)
+		b.WriteString("]")
+	}
+}
+
+func writeOperand(b *strings.Builder, n node, prec int) {
+	if precedence(n) < prec {
+		b.WriteString("(")
+		writeNode(b, n)
+		b.WriteString(")")
+		return
+	}
+	writeNode(b, n)
+}
+
+func writeList(b *strings.Builder, nodes []node) {
+	for i, n := range nodes {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		writeNode(b, n)
+	}
+}
+
+// formatValue 将值转换成表达式中的写法, 字符串会加上引号
+func formatValue(v Value) string {
+	switch v.vType {
+	case Nil:
+		return "nil"
+	case Number:
+		return formatNumber(v.val)
+	case String:
+		s := v.val.(string)
+		// 表达式中的字符串没有转义, 选一个字符串中没有出现的引号
+		for _, quote := range []string{`"`, `'`, "`"} {
+			if !strings.Contains(s, quote) {
+				return quote + s + quote
+			}
+		}
+		return strconv.Quote(s)
+	case List:
+		items := v.val.([]Value)
+		s := make([]string, len(items))
+		for i, item := range items {
+			s[i] = formatValue(item)
+		}
+		return "[" + strings.Join(s, ", ") + "]"
+	case Time:
+		return `"` + v.String() + `"`
+	case Duration:
+		return formatDuration(v.val.(time.Duration))
+	case Error:
+		return "error(" + v.String() + ")"
+	}
+	return v.String()
+}
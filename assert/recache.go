@@ -0,0 +1,87 @@
+package assert
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"sync"
+
+	"github.com/cloudfly/golang/internal/lru"
+	"github.com/pkg/errors"
+)
+
+// 正则缓存和正则限制的默认值
+const (
+	DefaultRegexpCacheSize  = 1024
+	DefaultMaxRegexpLength  = 4096
+	DefaultMaxRegexpProgram = 20000
+)
+
+// recache 缓存执行时才知道的正则, 如 a =~ b 和 a = b, 常量的正则在 New 时已经编译好了
+var recache = lru.New(DefaultRegexpCacheSize)
+
+// relimits 是正则的长度和复杂度上限
+var relimits = struct {
+	sync.Mutex
+	maxLength, maxProgram int
+}{maxLength: DefaultMaxRegexpLength, maxProgram: DefaultMaxRegexpProgram}
+
+// CacheStats 是缓存的统计信息
+type CacheStats = lru.Stats
+
+// SetRegexpCacheSize 设置正则缓存的容量, 超出的正则按最近最少使用的顺序淘汰, size <= 0 时不缓存
+func SetRegexpCacheSize(size int) {
+	recache.Resize(size)
+}
+
+// RegexpCacheStats 返回正则缓存的统计信息
+func RegexpCacheStats() CacheStats {
+	return recache.Stats()
+}
+
+// SetRegexpLimits 设置正则的长度(字节)和复杂度(编译后的指令数)上限, 超出的正则无法编译, 0 表示不限制.
+// RE2 的匹配时间与输入长度是线性的, 但是过于复杂的正则会占用大量的内存和 CPU
+func SetRegexpLimits(maxLength, maxProgram int) {
+	relimits.Lock()
+	defer relimits.Unlock()
+	relimits.maxLength, relimits.maxProgram = maxLength, maxProgram
+}
+
+// compileRegexp 编译正则, 结果保存在有容量限制的缓存中
+func compileRegexp(pattern string) (*regexp.Regexp, error) {
+	exp, err := recache.Get(pattern, func(pattern string) (interface{}, error) {
+		return precompileRegexp(pattern)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return exp.(*regexp.Regexp), nil
+}
+
+// precompileRegexp 编译常量的正则, 不使用缓存, 保存在语法树中
+func precompileRegexp(pattern string) (*regexp.Regexp, error) {
+	relimits.Lock()
+	maxLength, maxProgram := relimits.maxLength, relimits.maxProgram
+	relimits.Unlock()
+	return newRegexp(pattern, maxLength, maxProgram)
+}
+
+// newRegexp 检查正则的长度和复杂度后编译正则
+func newRegexp(pattern string, maxLength, maxProgram int) (*regexp.Regexp, error) {
+	if maxLength > 0 && len(pattern) > maxLength {
+		return nil, errors.Errorf("regular expression is too long: %d bytes, the limit is %d", len(pattern), maxLength)
+	}
+	if maxProgram > 0 {
+		re, err := syntax.Parse(pattern, syntax.Perl)
+		if err != nil {
+			return nil, err
+		}
+		prog, err := syntax.Compile(re.Simplify())
+		if err != nil {
+			return nil, err
+		}
+		if len(prog.Inst) > maxProgram {
+			return nil, errors.Errorf("regular expression is too complex: %d instructions, the limit is %d", len(prog.Inst), maxProgram)
+		}
+	}
+	return regexp.Compile(pattern)
+}
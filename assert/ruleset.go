@@ -0,0 +1,343 @@
+package assert
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// RuleSet 是一组一起编译和执行的规则, 用于同一个 KV 匹配大量规则的场景:
+//   - 规则之间相同的子表达式(包括变量读取)只保存一份, 一次 Match 中只执行一次
+//   - && 连接的顶层条件中的 a == "x" 和 a in ["x", "y"] 会被索引, 变量值不符的规则直接跳过
+//
+// RuleSet 可以被多个 goroutine 同时使用
+type RuleSet struct {
+	mu    sync.RWMutex
+	rules map[string]*rule
+	scan  ruleMap                     // 没有可索引条件的规则, 每次都需要执行
+	index map[node]map[string]ruleMap // 变量 => 变量值 => 规则
+	nodes map[string]node             // 所有规则共享的子表达式
+	dirty bool                        // 删除过规则, nodes 中可能有不再使用的子表达式
+}
+
+type rule struct {
+	id   string
+	code string
+	root node
+	key  node     // 被索引的变量, 为 nil 表示没有索引
+	vals []string // 变量值满足其中之一时规则才可能为 true
+}
+
+type ruleMap map[string]*rule
+
+// NewRuleSet 创建规则集, rules 的键为规则 ID, 值为表达式
+func NewRuleSet(rules map[string]string) (*RuleSet, error) {
+	s := &RuleSet{
+		rules: make(map[string]*rule),
+		scan:  make(ruleMap),
+		index: make(map[node]map[string]ruleMap),
+		nodes: make(map[string]node),
+	}
+	for id, code := range rules {
+		if err := s.Add(id, code); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Add 编译并添加一条规则, ID 已经存在时替换原来的规则
+func (s *RuleSet) Add(id, code string) error {
+	expr, err := New(code)
+	if err != nil {
+		return errors.Wrapf(err, "rule '%s'", id)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.rules[id]; ok {
+		s.remove(old)
+	}
+	if s.dirty {
+		s.compact()
+	}
+
+	r := &rule{id: id, code: code, root: s.intern(expr.root)}
+	r.key, r.vals = indexable(r.root)
+	s.rules[id] = r
+	if r.key == nil {
+		s.scan[id] = r
+		return nil
+	}
+	buckets, ok := s.index[r.key]
+	if !ok {
+		buckets = make(map[string]ruleMap)
+		s.index[r.key] = buckets
+	}
+	for _, val := range r.vals {
+		if buckets[val] == nil {
+			buckets[val] = make(ruleMap)
+		}
+		buckets[val][id] = r
+	}
+	return nil
+}
+
+// Remove 删除规则, 规则不存在时返回 false
+func (s *RuleSet) Remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.rules[id]
+	if ok {
+		s.remove(r)
+	}
+	return ok
+}
+
+func (s *RuleSet) remove(r *rule) {
+	delete(s.rules, r.id)
+	delete(s.scan, r.id)
+	if buckets, ok := s.index[r.key]; ok {
+		for _, val := range r.vals {
+			delete(buckets[val], r.id)
+			if len(buckets[val]) == 0 {
+				delete(buckets, val)
+			}
+		}
+		if len(buckets) == 0 {
+			delete(s.index, r.key)
+		}
+	}
+	s.dirty = true
+}
+
+// compact 只保留剩余规则用到的子表达式
+func (s *RuleSet) compact() {
+	s.nodes = make(map[string]node)
+	for _, r := range s.rules {
+		walk(r.root, func(n node) bool {
+			s.nodes[shape(n)] = n
+			return true
+		})
+	}
+	s.dirty = false
+}
+
+// Len 返回规则的数量
+func (s *RuleSet) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.rules)
+}
+
+// Get 返回规则的表达式
+func (s *RuleSet) Get(id string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.rules[id]
+	if !ok {
+		return "", false
+	}
+	return r.code, true
+}
+
+// Match 使用给定的变量执行所有规则, 返回结果为 true 的规则 ID, 按 ID 排序.
+// 执行出错的规则不算匹配, 所有出错的规则通过 *MatchError 返回, 这时仍然会返回匹配的规则
+func (s *RuleSet) Match(kv KV) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e := &evaluation{kv: kv, memo: make(map[node]Value)}
+	var (
+		matched []string
+		errs    map[string]error
+		checked = make(map[string]bool)
+	)
+	execute := func(rules ruleMap) {
+		for id, r := range rules {
+			if checked[id] {
+				continue
+			}
+			checked[id] = true
+			v := e.eval(r.root)
+			if err := v.Error(); err != nil {
+				if errs == nil {
+					errs = make(map[string]error)
+				}
+				errs[id] = err
+			} else if v.Boolean() {
+				matched = append(matched, id)
+			}
+		}
+	}
+
+	execute(s.scan)
+	for key, buckets := range s.index {
+		v := e.eval(key)
+		if _, ok := v.val.(float64); ok || v.vType == Error || v.vType == Time || v.vType == Duration {
+			// 不是按字符串比较, 执行所有规则
+			for _, rules := range buckets {
+				execute(rules)
+			}
+			continue
+		}
+		execute(buckets[v.String()])
+	}
+	sort.Strings(matched)
+	if errs != nil {
+		return matched, &MatchError{Errors: errs}
+	}
+	return matched, nil
+}
+
+// MatchError 是 RuleSet.Match 中执行出错的规则, 键为规则 ID
+type MatchError struct {
+	Errors map[string]error
+}
+
+func (e *MatchError) Error() string {
+	ids := make([]string, 0, len(e.Errors))
+	for id := range e.Errors {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	msgs := make([]string, len(ids))
+	for i, id := range ids {
+		msgs[i] = fmt.Sprintf("rule '%s': %s", id, e.Errors[id])
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// intern 自底向上将节点替换成已经存在的相同节点, 使规则之间共享子表达式
+func (s *RuleSet) intern(n node) node {
+	switch x := n.(type) {
+	case *unaryNode:
+		n = &unaryNode{pos: x.pos, op: x.op, x: s.intern(x.x)}
+	case *binaryNode:
+		n = &binaryNode{pos: x.pos, op: x.op, left: s.intern(x.left), right: s.intern(x.right)}
+	case *ternaryNode:
+		n = &ternaryNode{pos: x.pos, cond: s.intern(x.cond), yes: s.intern(x.yes), no: s.intern(x.no)}
+	case *callNode:
+		args := make([]node, len(x.args))
+		for i, arg := range x.args {
+			args[i] = s.intern(arg)
+		}
+		n = &callNode{pos: x.pos, name: x.name, args: args}
+	case *listNode:
+		items := make([]node, len(x.items))
+		for i, item := range x.items {
+			items[i] = s.intern(item)
+		}
+		n = &listNode{pos: x.pos, items: items}
+	case *fieldNode:
+		n = &fieldNode{pos: x.pos, x: s.intern(x.x), path: x.path}
+	case *indexNode:
+		n = &indexNode{pos: x.pos, x: s.intern(x.x), index: s.intern(x.index)}
+	}
+	key := shape(n)
+	if shared, ok := s.nodes[key]; ok {
+		return shared
+	}
+	s.nodes[key] = n
+	return n
+}
+
+// shape 是节点的结构, 子节点已经被 intern 过, 所以用子节点的地址表示
+func shape(n node) string {
+	switch n := n.(type) {
+	case *literalNode:
+		return fmt.Sprintf("literal %s %t %s", n.v.vType, n.re != nil, formatValue(n.v))
+	case *variableNode:
+		return "variable " + n.name
+	case *unaryNode:
+		return fmt.Sprintf("unary %d %p", n.op, n.x)
+	case *binaryNode:
+		return fmt.Sprintf("binary %d %p %p", n.op, n.left, n.right)
+	case *ternaryNode:
+		return fmt.Sprintf("ternary %p %p %p", n.cond, n.yes, n.no)
+	case *callNode:
+		return "call " + n.name + " " + shapes(n.args)
+	case *listNode:
+		return "list " + shapes(n.items)
+	case *fieldNode:
+		return fmt.Sprintf("field %p %s", n.x, strings.Join(n.path, "."))
+	case *indexNode:
+		return fmt.Sprintf("index %p %p", n.x, n.index)
+	}
+	return fmt.Sprintf("%T %p", n, n)
+}
+
+func shapes(nodes []node) string {
+	s := make([]string, len(nodes))
+	for i, n := range nodes {
+		s[i] = fmt.Sprintf("%p", n)
+	}
+	return strings.Join(s, " ")
+}
+
+// indexable 在 && 连接的顶层条件中查找变量与常量的相等比较, 返回变量和可能的变量值
+func indexable(root node) (node, []string) {
+	for _, n := range flatten(AND, root) {
+		b, ok := n.(*binaryNode)
+		if !ok {
+			continue
+		}
+		switch b.op {
+		case E:
+			left, right := b.left, b.right
+			if _, ok := left.(*literalNode); ok {
+				left, right = right, left
+			}
+			if val, ok := indexValue(right); ok && isVariable(left) {
+				return left, []string{val}
+			}
+		case IN:
+			list, ok := b.right.(*listNode)
+			if !ok || !isVariable(b.left) {
+				continue
+			}
+			vals := make([]string, 0, len(list.items))
+			for _, item := range list.items {
+				val, ok := indexValue(item)
+				if !ok {
+					break
+				}
+				vals = append(vals, val)
+			}
+			if len(vals) == len(list.items) {
+				return b.left, vals
+			}
+		}
+	}
+	return nil, nil
+}
+
+// indexValue 返回常量按字符串比较时的值, 只有 == 的结果等于字符串相等的常量才能被索引,
+// 浮点数按有效数字比较, 不能被索引
+func indexValue(n node) (string, bool) {
+	lit, ok := n.(*literalNode)
+	if !ok {
+		return "", false
+	}
+	switch lit.v.vType {
+	case Number:
+		if _, ok := lit.v.val.(float64); ok {
+			return "", false
+		}
+		fallthrough
+	case String, Boolean:
+		return lit.v.String(), true
+	}
+	return "", false
+}
+
+func isVariable(n node) bool {
+	switch n.(type) {
+	case *variableNode, *fieldNode, *indexNode:
+		return !isConstant(n)
+	}
+	return false
+}
@@ -0,0 +1,531 @@
+package assert
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dialect 是 WHERE 子句的方言
+type Dialect int
+
+// 支持的方言
+const (
+	InfluxQL Dialect = iota
+	SQL
+)
+
+func (d Dialect) String() string {
+	if d == InfluxQL {
+		return "InfluxQL"
+	}
+	return "SQL"
+}
+
+// PushdownError 表示表达式中有无法翻译成 WHERE 子句的部分, 只能在内存中执行
+type PushdownError struct {
+	Position
+	Dialect Dialect
+	Msg     string
+}
+
+func (e *PushdownError) Error() string {
+	return fmt.Sprintf("can not push down to %s at %s: %s", e.Dialect, e.Position, e.Msg)
+}
+
+// InfluxQL 将表达式翻译成 InfluxQL 的 WHERE 子句 (不含 WHERE 关键字), 见 Where
+func (l *Assert) InfluxQL() (string, error) {
+	return l.Where(InfluxQL)
+}
+
+// SQL 将表达式翻译成标准 SQL 的 WHERE 子句 (不含 WHERE 关键字), 见 Where
+func (l *Assert) SQL() (string, error) {
+	return l.Where(SQL)
+}
+
+// Where 将表达式翻译成指定方言的 WHERE 子句 (不含 WHERE 关键字).
+//
+// 变量翻译成带双引号的标识符, SQL 中 a.b 翻译成 "a"."b"; 字符串翻译成单引号字符串;
+// =~ 和 !~ 的右边必须是字符串常量, InfluxQL 中翻译成 /regex/, SQL 不支持;
+// = 的右边必须是字符串常量, InfluxQL 中翻译成正则, SQL 中翻译成 LIKE;
+// in 和 not in 的右边必须是列表常量, InfluxQL 中展开成多个 = 或 !=;
+// ?: 和 ?? 在 SQL 中翻译成 CASE WHEN 和 COALESCE, InfluxQL 不支持;
+// 一边是不能解析成数字的字符串常量的 + 是字符串拼接, 在 SQL 中翻译成 ||, InfluxQL 不支持;
+// == nil 和 != nil 在 SQL 中翻译成 IS NULL 和 IS NOT NULL, 在 InfluxQL 中翻译成与空字符串比较(只适用于 tag);
+// ! 在 SQL 中翻译成 NOT, InfluxQL 没有 NOT, 将否定推到比较运算中, 如 !(a == 1 && b < 2) 翻译成 ("a" != 1 OR "b" >= 2);
+// now() 和时间段常量翻译成对应方言的写法.
+// 其他函数调用, 字段和下标访问等无法下推的部分返回 *PushdownError
+func (l *Assert) Where(dialect Dialect) (string, error) {
+	w := whereWriter{assert: l, dialect: dialect}
+	if err := w.write(l.root, true); err != nil {
+		return "", err
+	}
+	return w.b.String(), nil
+}
+
+type whereWriter struct {
+	assert  *Assert
+	dialect Dialect
+	b       strings.Builder
+}
+
+func (w *whereWriter) errorf(n node, format string, args ...interface{}) error {
+	return &PushdownError{
+		Position: position(w.assert.code, int(n.position())),
+		Dialect:  w.dialect,
+		Msg:      fmt.Sprintf(format, args...),
+	}
+}
+
+// write 翻译节点 n, condition 为 true 时 n 处于需要布尔条件的位置, 如 && 的操作数
+func (w *whereWriter) write(n node, condition bool) error {
+	switch n := n.(type) {
+	case *literalNode:
+		if condition && w.dialect == InfluxQL {
+			return w.errorf(n, "constant %s can not be a condition", formatValue(n.v))
+		}
+		return w.literal(n, n.v)
+	case *variableNode:
+		w.identifier(n.name)
+		if condition {
+			w.b.WriteString(" = " + w.boolean(true))
+		}
+		return nil
+	case *unaryNode:
+		if n.op == NOT {
+			if w.dialect == InfluxQL { // InfluxQL 没有 NOT
+				return w.negate(n.x)
+			}
+			w.b.WriteString("NOT (")
+			if err := w.write(n.x, true); err != nil {
+				return err
+			}
+			w.b.WriteString(")")
+			return nil
+		}
+		// 变量和非负的数字常量之外都加上括号, 避免写出 SQL 的注释 --
+		switch x := n.x.(type) {
+		case *variableNode:
+			w.b.WriteString("-")
+			w.identifier(x.name)
+			return nil
+		case *literalNode:
+			if x.v.vType == Number && !strings.HasPrefix(formatNumber(x.v.val), "-") {
+				w.b.WriteString("-")
+				return w.literal(x, x.v)
+			}
+		}
+		w.b.WriteString("-(")
+		if err := w.write(n.x, false); err != nil {
+			return err
+		}
+		w.b.WriteString(")")
+		return nil
+	case *binaryNode:
+		return w.binary(n, condition)
+	case *ternaryNode:
+		if w.dialect != SQL {
+			return w.errorf(n, "conditional expression is not supported in %s", w.dialect)
+		}
+		w.b.WriteString("CASE WHEN ")
+		if err := w.write(n.cond, true); err != nil {
+			return err
+		}
+		w.b.WriteString(" THEN ")
+		if err := w.write(n.yes, condition); err != nil {
+			return err
+		}
+		w.b.WriteString(" ELSE ")
+		if err := w.write(n.no, condition); err != nil {
+			return err
+		}
+		w.b.WriteString(" END")
+		return nil
+	case *callNode:
+		if n.name == "now" && len(n.args) == 0 {
+			if w.dialect == InfluxQL {
+				w.b.WriteString("now()")
+			} else {
+				w.b.WriteString("CURRENT_TIMESTAMP")
+			}
+			return nil
+		}
+		return w.errorf(n, "function '%s' can not be pushed down", n.name)
+	case *listNode:
+		return w.errorf(n, "list can only be used on the right of in and not in")
+	case *fieldNode, *indexNode:
+		return w.errorf(n, "field and index access can not be pushed down")
+	}
+	return w.errorf(n, "unsupported expression %s", format(n))
+}
+
+// negated 是比较运算取反后的运算
+var negated = map[int]int{
+	E: NE, NE: E,
+	LT: GTE, GTE: LT,
+	GT: LTE, LTE: GT,
+	RE: NRE, NRE: RE,
+	IN: NOTIN, NOTIN: IN,
+}
+
+// negate 翻译 !n. InfluxQL 没有 NOT, 将否定推到比较运算中: == 变成 !=, < 变成 >= 等,
+// && 和 || 按德摩根定律展开; 无法取反的表达式返回 *PushdownError
+func (w *whereWriter) negate(n node) error {
+	switch n := n.(type) {
+	case *variableNode:
+		w.identifier(n.name)
+		w.b.WriteString(" != " + w.boolean(true))
+		return nil
+	case *unaryNode:
+		if n.op == NOT {
+			return w.write(n.x, true)
+		}
+	case *binaryNode:
+		switch n.op {
+		case AND: // !(a && b) 是 !a || !b, 加上括号保持原来的优先级
+			w.b.WriteString("(")
+			if err := w.negate(n.left); err != nil {
+				return err
+			}
+			w.b.WriteString(" OR ")
+			if err := w.negate(n.right); err != nil {
+				return err
+			}
+			w.b.WriteString(")")
+			return nil
+		case OR: // !(a || b) 是 !a && !b
+			if err := w.negate(n.left); err != nil {
+				return err
+			}
+			w.b.WriteString(" AND ")
+			return w.negate(n.right)
+		case MATCH, IMATCH:
+			pattern, ok := stringLiteral(n.right)
+			if !ok {
+				return w.errorf(n, "the right of %s must be a string constant", operators[n.op])
+			}
+			expr, err := globToRegexp(pattern, n.op == IMATCH, false)
+			if err != nil {
+				return w.errorf(n.right, "%s", err)
+			}
+			return w.regex(&binaryNode{pos: n.pos, op: NRE, left: n.left, right: n.right}, expr)
+		}
+		if op, ok := negated[n.op]; ok {
+			return w.binary(&binaryNode{pos: n.pos, op: op, left: n.left, right: n.right}, true)
+		}
+	}
+	return w.errorf(n, "NOT of %s is not supported in %s", format(n), w.dialect)
+}
+
+func (w *whereWriter) operand(n node, prec int, condition bool) error {
+	if precedence(n) < prec {
+		w.b.WriteString("(")
+		if err := w.write(n, condition); err != nil {
+			return err
+		}
+		w.b.WriteString(")")
+		return nil
+	}
+	return w.write(n, condition)
+}
+
+func (w *whereWriter) binary(n *binaryNode, condition bool) error {
+	p := precedence(n)
+	switch n.op {
+	case AND, OR:
+		if err := w.operand(n.left, p, true); err != nil {
+			return err
+		}
+		if n.op == AND {
+			w.b.WriteString(" AND ")
+		} else {
+			w.b.WriteString(" OR ")
+		}
+		return w.operand(n.right, p+1, true)
+	case RE, NRE:
+		if w.dialect != InfluxQL {
+			return w.errorf(n, "regular expression is not supported in %s", w.dialect)
+		}
+		pattern, ok := stringLiteral(n.right)
+		if !ok {
+			return w.errorf(n, "the right of %s must be a string constant", operators[n.op])
+		}
+		return w.regex(n, pattern)
+	case MATCH, IMATCH:
+		pattern, ok := stringLiteral(n.right)
+		if !ok {
+			return w.errorf(n, "the right of %s must be a string constant", operators[n.op])
+		}
+		if w.dialect == InfluxQL {
+			expr, err := globToRegexp(pattern, n.op == IMATCH, false)
+			if err != nil {
+				return w.errorf(n.right, "%s", err)
+			}
+			return w.regex(n, expr)
+		}
+		like, ok := globToLike(pattern)
+		if !ok {
+			return w.errorf(n.right, "glob pattern '%s' can not be translated to LIKE, character classes are not supported", pattern)
+		}
+		if n.op == IMATCH {
+			w.b.WriteString("LOWER(")
+			if err := w.operand(n.left, p, false); err != nil {
+				return err
+			}
+			w.b.WriteString(") LIKE " + w.str(strings.ToLower(like)) + ` ESCAPE '\'`)
+			return nil
+		}
+		if err := w.operand(n.left, p, false); err != nil {
+			return err
+		}
+		w.b.WriteString(" LIKE " + w.str(like) + ` ESCAPE '\'`)
+		return nil
+	case INCIDR, NOTINCIDR:
+		return w.errorf(n, "%s is not supported in %s", operators[n.op], w.dialect)
+	case IN, NOTIN:
+		return w.in(n)
+	case COALESCE:
+		if w.dialect != SQL {
+			return w.errorf(n, "?? is not supported in %s", w.dialect)
+		}
+		w.b.WriteString("COALESCE(")
+		if err := w.write(n.left, false); err != nil {
+			return err
+		}
+		w.b.WriteString(", ")
+		if err := w.write(n.right, false); err != nil {
+			return err
+		}
+		w.b.WriteString(")")
+		if condition {
+			w.b.WriteString(" = " + w.boolean(true))
+		}
+		return nil
+	case E, NE:
+		if lit, ok := n.right.(*literalNode); ok && lit.v.vType == Nil {
+			return w.null(n, n.left)
+		}
+		if lit, ok := n.left.(*literalNode); ok && lit.v.vType == Nil {
+			return w.null(n, n.right)
+		}
+	}
+
+	op := operators[n.op]
+	switch n.op {
+	case E:
+		op = "="
+	case NE:
+		if w.dialect == SQL {
+			op = "<>"
+		}
+	case '+':
+		if isConcat(n) { // 字符串拼接
+			if w.dialect != SQL {
+				return w.errorf(n, "string concatenation is not supported in %s", w.dialect)
+			}
+			op = "||"
+		}
+	}
+	if err := w.operand(n.left, p, false); err != nil {
+		return err
+	}
+	w.b.WriteString(" " + op + " ")
+	return w.operand(n.right, p+1, false)
+}
+
+// null 翻译与 nil 的比较
+func (w *whereWriter) null(n *binaryNode, x node) error {
+	if err := w.operand(x, precCompare+1, false); err != nil {
+		return err
+	}
+	switch {
+	case w.dialect == SQL && n.op == E:
+		w.b.WriteString(" IS NULL")
+	case w.dialect == SQL:
+		w.b.WriteString(" IS NOT NULL")
+	case n.op == E:
+		w.b.WriteString(" = ''")
+	default:
+		w.b.WriteString(" != ''")
+	}
+	return nil
+}
+
+func (w *whereWriter) regex(n *binaryNode, pattern string) error {
+	if _, err := precompileRegexp(pattern); err != nil {
+		return w.errorf(n.right, "%s", err)
+	}
+	if err := w.operand(n.left, precCompare, false); err != nil {
+		return err
+	}
+	op := " =~ "
+	if n.op == NRE {
+		op = " !~ "
+	}
+	w.b.WriteString(op + "/" + strings.Replace(pattern, "/", `\/`, -1) + "/")
+	return nil
+}
+
+func (w *whereWriter) in(n *binaryNode) error {
+	list, ok := n.right.(*listNode)
+	if !ok {
+		return w.errorf(n, "the right of %s must be a list constant", operators[n.op])
+	}
+	for _, item := range list.items {
+		if _, ok := item.(*literalNode); !ok {
+			return w.errorf(item, "list item must be a constant")
+		}
+	}
+	if len(list.items) == 0 { // x in [] 总是 false, x not in [] 总是 true
+		if n.op == IN {
+			w.b.WriteString("1 = 0")
+		} else {
+			w.b.WriteString("1 = 1")
+		}
+		return nil
+	}
+
+	if w.dialect == SQL {
+		if err := w.operand(n.left, precCompare+1, false); err != nil {
+			return err
+		}
+		if n.op == IN {
+			w.b.WriteString(" IN (")
+		} else {
+			w.b.WriteString(" NOT IN (")
+		}
+		for i, item := range list.items {
+			if i > 0 {
+				w.b.WriteString(", ")
+			}
+			if err := w.write(item, false); err != nil {
+				return err
+			}
+		}
+		w.b.WriteString(")")
+		return nil
+	}
+
+	// InfluxQL 没有 IN, 展开成 (a = 1 OR a = 2) 或 (a != 1 AND a != 2)
+	op, join := " = ", " OR "
+	if n.op == NOTIN {
+		op, join = " != ", " AND "
+	}
+	w.b.WriteString("(")
+	for i, item := range list.items {
+		if i > 0 {
+			w.b.WriteString(join)
+		}
+		if err := w.operand(n.left, precCompare+1, false); err != nil {
+			return err
+		}
+		w.b.WriteString(op)
+		if err := w.write(item, false); err != nil {
+			return err
+		}
+	}
+	w.b.WriteString(")")
+	return nil
+}
+
+func (w *whereWriter) literal(n node, v Value) error {
+	switch v.vType {
+	case Number:
+		w.b.WriteString(formatNumber(v.val))
+	case String:
+		w.b.WriteString(w.str(v.val.(string)))
+	case Boolean:
+		w.b.WriteString(w.boolean(v.val.(bool)))
+	case Duration:
+		w.b.WriteString(w.duration(v.val.(time.Duration)))
+	case Time:
+		w.b.WriteString(w.str(v.String()))
+	case Nil:
+		if w.dialect == InfluxQL {
+			return w.errorf(n, "nil can only be compared with == or !=")
+		}
+		w.b.WriteString("NULL")
+	default:
+		return w.errorf(n, "%s value can not be pushed down", v.vType)
+	}
+	return nil
+}
+
+func (w *whereWriter) identifier(name string) {
+	if w.dialect == InfluxQL {
+		w.b.WriteString(`"` + strings.Replace(strings.Replace(name, `\`, `\\`, -1), `"`, `\"`, -1) + `"`)
+		return
+	}
+	for i, part := range strings.Split(name, ".") {
+		if i > 0 {
+			w.b.WriteString(".")
+		}
+		w.b.WriteString(`"` + strings.Replace(part, `"`, `""`, -1) + `"`)
+	}
+}
+
+func (w *whereWriter) str(s string) string {
+	if w.dialect == InfluxQL {
+		return "'" + strings.Replace(strings.Replace(s, `\`, `\\`, -1), "'", `\'`, -1) + "'"
+	}
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+func (w *whereWriter) boolean(b bool) string {
+	if w.dialect == InfluxQL {
+		return strconv.FormatBool(b)
+	}
+	return strings.ToUpper(strconv.FormatBool(b))
+}
+
+// duration 翻译时间段, 使用能整除的最大单位
+func (w *whereWriter) duration(d time.Duration) string {
+	units := []struct {
+		d        time.Duration
+		influxQL string
+		sql      string
+	}{
+		{time.Hour, "h", "HOUR"},
+		{time.Minute, "m", "MINUTE"},
+		{time.Second, "s", "SECOND"},
+		{time.Millisecond, "ms", ""},
+		{time.Microsecond, "u", ""},
+		{time.Nanosecond, "ns", ""},
+	}
+	for _, unit := range units {
+		if d%unit.d != 0 {
+			continue
+		}
+		n := strconv.FormatInt(int64(d/unit.d), 10)
+		if w.dialect == InfluxQL {
+			return n + unit.influxQL
+		}
+		if unit.sql != "" {
+			return "INTERVAL '" + n + "' " + unit.sql
+		}
+		break
+	}
+	return "INTERVAL '" + strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "' SECOND"
+}
+
+// isConcat 判断 + 是否是字符串拼接: 任意一边是不能解析成数字的字符串常量或者字符串拼接
+func isConcat(n *binaryNode) bool {
+	for _, x := range []node{n.left, n.right} {
+		if lit, ok := x.(*literalNode); ok && isText(lit.v) {
+			return true
+		}
+		if b, ok := x.(*binaryNode); ok && b.op == '+' && isConcat(b) {
+			return true
+		}
+	}
+	return false
+}
+
+func stringLiteral(n node) (string, bool) {
+	lit, ok := n.(*literalNode)
+	if !ok || lit.v.vType != String {
+		return "", false
+	}
+	return lit.v.val.(string), true
+}
@@ -0,0 +1,200 @@
+package assert
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// Time 将值转换为时间, 字符串按 RFC3339 格式解析, 数字是 unix 时间戳(秒), 所以 now() > 0 这样的规则仍然可以执行
+func (v Value) Time() (time.Time, error) {
+	switch v.vType {
+	case Time:
+		return v.val.(time.Time), nil
+	case Number:
+		f := toFloat(v.val)
+		sec := math.Floor(f)
+		return time.Unix(int64(sec), int64((f-sec)*float64(time.Second))), nil
+	case String:
+		t, err := time.Parse(time.RFC3339Nano, v.val.(string))
+		if err != nil {
+			return t, errors.Errorf("can not convert '%s' to time, should be in RFC3339 format", v.val)
+		}
+		return t, nil
+	case Error:
+		return time.Time{}, v.Error()
+	}
+	if v.name == "" {
+		return time.Time{}, errors.Errorf("can not convert %s value to time", v.vType)
+	}
+	return time.Time{}, errors.Errorf("variable '%s' is %s, can not convert to time", v.name, v.vType)
+}
+
+// Duration 将值转换为时间段, 字符串按 time.ParseDuration 的格式解析
+func (v Value) Duration() (time.Duration, error) {
+	switch v.vType {
+	case Duration:
+		return v.val.(time.Duration), nil
+	case String:
+		d, err := time.ParseDuration(v.val.(string))
+		if err != nil {
+			return d, errors.Errorf("can not convert '%s' to duration", v.val)
+		}
+		return d, nil
+	case Error:
+		return 0, v.Error()
+	}
+	if v.name == "" {
+		return 0, errors.Errorf("can not convert %s value to duration", v.vType)
+	}
+	return 0, errors.Errorf("variable '%s' is %s, can not convert to duration", v.name, v.vType)
+}
+
+// isTemporal 检查是否有一个值是时间或时间段, 这时按时间的规则运算, 字符串会被转换
+func isTemporal(v, v2 Value) bool {
+	return v.vType == Time || v.vType == Duration || v2.vType == Time || v2.vType == Duration
+}
+
+// isTimeStrings 检查两个值是否都是 RFC3339 格式的字符串, 这时按时间比较, 而不是按数字比较
+func isTimeStrings(v, v2 Value) bool {
+	if v.vType != String || v2.vType != String {
+		return false
+	}
+	_, err := v.Time()
+	_, err2 := v2.Time()
+	return err == nil && err2 == nil
+}
+
+// temporalCompare 比较两个时间或者时间段, 返回 -1, 0, 1
+func temporalCompare(v, v2 Value) (int, error) {
+	if v.vType == Time || v2.vType == Time || isTimeStrings(v, v2) {
+		t, err := v.Time()
+		if err != nil {
+			return 0, err
+		}
+		t2, err := v2.Time()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case t.Before(t2):
+			return -1, nil
+		case t.After(t2):
+			return 1, nil
+		}
+		return 0, nil
+	}
+	d, err := v.Duration()
+	if err != nil {
+		return 0, err
+	}
+	d2, err := v2.Duration()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case d < d2:
+		return -1, nil
+	case d > d2:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func temporalCompareValue(v, v2 Value, ok func(c int) bool) Value {
+	c, err := temporalCompare(v, v2)
+	if err != nil {
+		return errorValue(err)
+	}
+	return Value{
+		val:   ok(c),
+		vType: Boolean,
+	}
+}
+
+// temporalArith 计算时间和时间段的 + - * /:
+//
+//	time ± duration = time, time - time = duration, duration ± duration = duration,
+//	duration * number = duration, duration / number = duration, duration / duration = number,
+//	time - number 和 number - time 中的数字是 unix 时间戳, 结果是相差的秒数, 如 now() - ts > 300
+func temporalArith(op int, v, v2 Value) Value {
+	if err := firstError(v, v2); err.vType == Error {
+		return err
+	}
+	switch {
+	case op == '-' && (v.vType == Time && v2.vType == Number || v.vType == Number && v2.vType == Time):
+		t, _ := v.Time()
+		t2, _ := v2.Time()
+		return NewValue("", t.Sub(t2).Seconds())
+	case op == '+' && v2.vType == Time:
+		v, v2 = v2, v
+		fallthrough
+	case (op == '+' || op == '-') && v.vType == Time:
+		t, _ := v.Time()
+		if op == '-' && v2.vType != Duration {
+			if t2, err := v2.Time(); err == nil {
+				return NewValue("", t.Sub(t2))
+			}
+		}
+		d, err := v2.Duration()
+		if err != nil {
+			return errorValue(err)
+		}
+		if op == '-' {
+			d = -d
+		}
+		return NewValue("", t.Add(d))
+	case op == '-' && v2.vType == Time: // "2026-01-01T00:00:00Z" - time
+		t, err := v.Time()
+		if err != nil {
+			return errorValue(err)
+		}
+		return NewValue("", t.Sub(v2.val.(time.Time)))
+	case op == '+' || op == '-':
+		d, err := v.Duration()
+		if err != nil {
+			return errorValue(err)
+		}
+		d2, err := v2.Duration()
+		if err != nil {
+			return errorValue(err)
+		}
+		if op == '-' {
+			d2 = -d2
+		}
+		return NewValue("", d+d2)
+	case op == '*' && v.vType == Number:
+		v, v2 = v2, v
+		fallthrough
+	case op == '*' || op == '/':
+		d, err := v.Duration()
+		if err != nil {
+			return errorValue(err)
+		}
+		if op == '/' && v2.vType == Duration {
+			return NewValue("", float64(d)/float64(v2.val.(time.Duration)))
+		}
+		f, err := v2.Float()
+		if err != nil {
+			return errorValue(err)
+		}
+		if op == '*' {
+			return NewValue("", time.Duration(float64(d)*f))
+		}
+		return NewValue("", time.Duration(float64(d)/f))
+	}
+	return errorValue(errors.Errorf("invalid operation between %s value and %s value", v.vType, v2.vType))
+}
+
+// formatDuration 将时间段写成表达式中的字面量, 词法分析只支持 ASCII 字符, 所以 µs 写成 us
+func formatDuration(d time.Duration) string {
+	return strings.Replace(d.String(), "µs", "us", 1)
+}
@@ -1,18 +1,19 @@
 package assert
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
-	"sync"
+	"time"
 
-	"github.com/cloudfly/golang/tools"
 	"github.com/pkg/errors"
 )
 
 var (
-	recache sync.Map
 	// 全局可复用的常量 value
 	trueValue  Value
 	falseValue Value
@@ -25,20 +26,27 @@ func init() {
 	nilValue = NewValue("", nil)
 }
 
+// Kind 是 Value 的类型
+type Kind uint8
+
 // Value types
 const (
-	Nil = iota
+	Nil Kind = iota
 	Boolean
 	Number
 	String
 	Error
+	List
+	Object
+	Time
+	Duration
 )
 
 // Value represents a variable in expression
 type Value struct {
 	name  string
 	val   interface{}
-	vType uint8
+	vType Kind
 }
 
 // NewValue create a new value
@@ -54,6 +62,10 @@ func NewValue(name string, v interface{}) Value {
 	switch r := v.(type) {
 	case bool:
 		res.vType = Boolean
+	case time.Time:
+		res.vType = Time
+	case time.Duration:
+		res.vType = Duration
 	case []byte:
 		res.val = string(r)
 		res.vType = String
@@ -65,36 +77,74 @@ func NewValue(name string, v interface{}) Value {
 		res.val = float64(r)
 		res.vType = Number
 	case int:
-		res.val = float64(r)
+		res.val = int64(r)
 		res.vType = Number
 	case int8:
-		res.val = float64(r)
+		res.val = int64(r)
 		res.vType = Number
 	case int16:
-		res.val = float64(r)
+		res.val = int64(r)
 		res.vType = Number
 	case int32:
-		res.val = float64(r)
+		res.val = int64(r)
 		res.vType = Number
 	case int64:
-		res.val = float64(r)
 		res.vType = Number
 	case uint:
-		res.val = float64(r)
+		res.val = uint64(r)
 		res.vType = Number
 	case uint8:
-		res.val = float64(r)
+		res.val = uint64(r)
 		res.vType = Number
 	case uint16:
-		res.val = float64(r)
+		res.val = uint64(r)
 		res.vType = Number
 	case uint32:
-		res.val = float64(r)
+		res.val = uint64(r)
 		res.vType = Number
 	case uint64:
-		res.val = float64(r)
 		res.vType = Number
+	case []Value:
+		res.vType = List
+	case []string:
+		items := make([]Value, len(r))
+		for i, item := range r {
+			items[i] = NewValue("", item)
+		}
+		res.val = items
+		res.vType = List
+	case []interface{}:
+		items := make([]Value, len(r))
+		for i, item := range r {
+			items[i] = NewValue("", item)
+		}
+		res.val = items
+		res.vType = List
 	default:
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			items := make([]Value, rv.Len())
+			for i := range items {
+				items[i] = NewValue("", rv.Index(i).Interface())
+			}
+			res.val = items
+			res.vType = List
+			return res
+		case reflect.Map, reflect.Struct:
+			// 对象保留原始值, 由 Field 和 Index 按需访问
+			res.vType = Object
+			return res
+		case reflect.Ptr:
+			if rv.IsNil() {
+				res.val = nil
+				return res
+			}
+			if rv.Elem().Kind() == reflect.Struct {
+				res.vType = Object
+				return res
+			}
+		}
 		s := fmt.Sprintf("%v", v)
 		f, err := strconv.ParseFloat(s, 64)
 		if err == nil {
@@ -114,10 +164,92 @@ func NewValue(name string, v interface{}) Value {
 	return res
 }
 
+func (k Kind) String() string {
+	switch k {
+	case Nil:
+		return "nil"
+	case Boolean:
+		return "boolean"
+	case Number:
+		return "number"
+	case String:
+		return "string"
+	case Error:
+		return "error"
+	case List:
+		return "list"
+	case Object:
+		return "object"
+	case Time:
+		return "time"
+	case Duration:
+		return "duration"
+	}
+	return "any"
+}
+
+// Interface 返回值对应的 Go 类型的值, 数字为 int64, uint64 或 float64, 列表为 []interface{}, Error 返回 error
+func (v Value) Interface() interface{} {
+	switch v.vType {
+	case List:
+		items := v.val.([]Value)
+		res := make([]interface{}, len(items))
+		for i, item := range items {
+			res[i] = item.Interface()
+		}
+		return res
+	case Error:
+		return v.Error()
+	}
+	return v.val
+}
+
+// Kind 返回值的类型
+func (v Value) Kind() Kind {
+	return v.vType
+}
+
+// MarshalJSON 将值编码为对应的 JSON 类型, Error 编码为错误信息
+func (v Value) MarshalJSON() ([]byte, error) {
+	switch v.vType {
+	case Nil:
+		return []byte("null"), nil
+	case Number:
+		if f, ok := v.val.(float64); ok && (math.IsInf(f, 0) || math.IsNaN(f)) {
+			return json.Marshal(v.String())
+		}
+	case String, Error:
+		return json.Marshal(v.String())
+	case Duration:
+		return json.Marshal(v.val.(time.Duration).String())
+	case Object:
+		if b, err := json.Marshal(v.val); err == nil {
+			return b, nil
+		}
+		return json.Marshal(v.String())
+	}
+	return json.Marshal(v.val)
+}
+
+func errorValue(err error) Value {
+	return Value{
+		val:   err.Error(),
+		vType: Error,
+	}
+}
+
+// firstError 返回两个值中第一个 Error 类型的值
+func firstError(v, v2 Value) Value {
+	if v2.vType == Error && v.vType != Error {
+		return v2
+	}
+	return v
+}
+
 func (v Value) Float() (float64, error) {
 	switch v.vType {
 	case Number:
-		return v.val.(float64), nil
+		return toFloat(v.val), nil
 	case String:
 		f, err := strconv.ParseFloat(fmt.Sprintf("%v", v.val), 64)
 		if err != nil {
@@ -131,6 +263,21 @@ func (v Value) Float() (float64, error) {
 		return 0, fmt.Errorf("variable '%s' is nil, can not convert to number", v.name)
 	case Error:
 		return 0, fmt.Errorf("%v", v.val)
+	case List:
+		if v.name == "" {
+			return 0, errors.New("can not convert list to number")
+		}
+		return 0, fmt.Errorf("variable '%s' is a list, can not convert to number", v.name)
+	case Object:
+		if v.name == "" {
+			return 0, errors.New("can not convert object to number")
+		}
+		return 0, fmt.Errorf("variable '%s' is an object, can not convert to number", v.name)
+	case Time, Duration:
+		if v.name == "" {
+			return 0, fmt.Errorf("can not convert %s to number", v.vType)
+		}
+		return 0, fmt.Errorf("variable '%s' is %s, can not convert to number", v.name, v.vType)
 	}
 	if v.name == "" {
 		return 0, errors.New("unknown value type")
@@ -139,8 +286,18 @@ func (v Value) Float() (float64, error) {
 }
 
 func (v Value) String() string {
-	if v.vType == String {
+	switch v.vType {
+	case String:
 		return v.val.(string)
+	case List:
+		items := v.val.([]Value)
+		s := make([]string, len(items))
+		for i, item := range items {
+			s[i] = item.String()
+		}
+		return "[" + strings.Join(s, ", ") + "]"
+	case Time:
+		return v.val.(time.Time).Format(time.RFC3339Nano)
 	}
 	return fmt.Sprintf("%v", v.val)
 }
@@ -150,6 +307,10 @@ func (v Value) Boolean() bool {
 		return v.val.(bool)
 	} else if v.vType == Error || v.vType == Nil {
 		return false
+	} else if v.vType == List {
+		return len(v.val.([]Value)) > 0
+	} else if v.vType == Object {
+		return true
 	}
 	s := strings.ToLower(fmt.Sprintf("%v", v.val))
 	return s != "" && s != "false"
@@ -193,37 +354,57 @@ func (v Value) Or(v2 Value) Value {
 }
 
 func (v Value) E(v2 Value) Value {
-	return Value{
-		val:   v.String() == v2.String(),
-		vType: Boolean,
+	if err := firstError(v, v2); err.vType == Error {
+		return err
 	}
-}
-
-func (v Value) RE(v2 Value) Value {
-	exp, err := compileRegexp(v2.String())
-	if err != nil {
+	if isTemporal(v, v2) {
+		c, err := temporalCompare(v, v2)
 		return Value{
-			val:   err.Error(),
-			vType: Error,
+			val:   err == nil && c == 0,
+			vType: Boolean,
+		}
+	}
+	if v.vType == Number && v2.vType == Number {
+		c, ok := compareNumbers(v.val, v2.val)
+		return Value{
+			val:   ok && c == 0,
+			vType: Boolean,
 		}
 	}
 	return Value{
-		val:   exp.MatchString(v.String()),
+		val:   v.String() == v2.String(),
 		vType: Boolean,
 	}
 }
 
+// RE 检查 v 是否匹配正则 v2
+func (v Value) RE(v2 Value) Value {
+	return v.regexp(v2, false)
+}
+
+// NRE 检查 v 是否不匹配正则 v2
 func (v Value) NRE(v2 Value) Value {
-	exp, err := regexp.Compile(v2.String())
+	return v.regexp(v2, true)
+}
+
+func (v Value) regexp(v2 Value, not bool) Value {
+	if err := firstError(v, v2); err.vType == Error {
+		return err
+	}
+	exp, err := compileRegexp(v2.String())
 	if err != nil {
-		return Value{
-			val:   err.Error(),
-			vType: Error,
-		}
+		return errorValue(err)
 	}
+	return v.matchRegexp(exp, not)
+}
 
+// matchRegexp 使用编译好的正则匹配 v, not 为 true 时结果取反
+func (v Value) matchRegexp(exp *regexp.Regexp, not bool) Value {
+	if v.vType == Error {
+		return v
+	}
 	return Value{
-		val:   !exp.MatchString(v.String()),
+		val:   exp.MatchString(v.String()) != not,
 		vType: Boolean,
 	}
 }
@@ -233,210 +414,142 @@ func (v Value) NE(v2 Value) Value {
 }
 
 func (v Value) GT(v2 Value) Value {
-	left, err := v.Float()
-	if err != nil {
-		return Value{
-			val:   err.Error(),
-			vType: Error,
-		}
-	}
-	right, err := v2.Float()
-	if err != nil {
-		return Value{
-			val:   err.Error(),
-			vType: Error,
-		}
-	}
-	return Value{
-		val:   left > right,
-		vType: Boolean,
-	}
+	return numericCompare(v, v2, func(c int) bool { return c > 0 })
 }
 
 func (v Value) GTE(v2 Value) Value {
-	left, err := v.Float()
-	if err != nil {
-		return Value{
-			val:   err.Error(),
-			vType: Error,
-		}
-	}
-	right, err := v2.Float()
-	if err != nil {
-		return Value{
-			val:   err.Error(),
-			vType: Error,
-		}
-	}
-	return Value{
-		val:   left >= right,
-		vType: Boolean,
-	}
+	return numericCompare(v, v2, func(c int) bool { return c >= 0 })
 }
 
 func (v Value) LT(v2 Value) Value {
-	left, err := v.Float()
-	if err != nil {
-		return Value{
-			val:   err.Error(),
-			vType: Error,
-		}
-	}
-	right, err := v2.Float()
-	if err != nil {
-		return Value{
-			val:   err.Error(),
-			vType: Error,
-		}
-	}
-	return Value{
-		val:   left < right,
-		vType: Boolean,
-	}
+	return numericCompare(v, v2, func(c int) bool { return c < 0 })
 }
 
 func (v Value) LTE(v2 Value) Value {
-	left, err := v.Float()
-	if err != nil {
-		return Value{
-			val:   err.Error(),
-			vType: Error,
-		}
-	}
-	right, err := v2.Float()
-	if err != nil {
-		return Value{
-			val:   err.Error(),
-			vType: Error,
-		}
-	}
-	return Value{
-		val:   left <= right,
-		vType: Boolean,
-	}
+	return numericCompare(v, v2, func(c int) bool { return c <= 0 })
 }
 
+// MATCH 检查 v 是否匹配通配符 v2, 通配符的语法见 globToRegexp
 func (v Value) MATCH(v2 Value) Value {
-	return Value{
-		val:   tools.SimpleMatch(v2.String(), v.String()),
-		vType: Boolean,
-	}
+	return v.match(v2, false)
 }
 
-func (v Value) Add(v2 Value) Value {
-	f, err := v.Float()
-	if err != nil {
-		return Value{
-			val:   v.String() + v2.String(),
-			vType: String,
-		}
+// IMATCH 和 MATCH 一样, 但是忽略大小写
+func (v Value) IMATCH(v2 Value) Value {
+	return v.match(v2, true)
+}
+
+func (v Value) match(v2 Value, ignoreCase bool) Value {
+	if err := firstError(v, v2); err.vType == Error {
+		return err
 	}
-	f2, err := v2.Float()
+	ok, err := matchGlob(v2.String(), v.String(), ignoreCase, false)
 	if err != nil {
-		return Value{
-			val:   v.String() + v2.String(),
-			vType: String,
-		}
+		return errorValue(err)
 	}
 	return Value{
-		val:   f + f2,
-		vType: Number,
+		val:   ok,
+		vType: Boolean,
 	}
 }
 
-func (v Value) Sub(v2 Value) Value {
-	f, err := v.Float()
-	if err != nil {
-		return Value{
-			val:   err.Error(),
-			vType: Error,
+// In 检查 v 是否在列表 v2 中, 元素按 == 的规则比较; v2 是字符串时检查是否为子串
+func (v Value) In(v2 Value) Value {
+	if err := firstError(v, v2); err.vType == Error {
+		return err
+	}
+	switch v2.vType {
+	case List:
+		for _, item := range v2.val.([]Value) {
+			if v.E(item).Boolean() {
+				return trueValue
+			}
 		}
-	}
-	f2, err := v2.Float()
-	if err != nil {
+		return falseValue
+	case String:
 		return Value{
-			val:   err.Error(),
-			vType: Error,
+			val:   strings.Contains(v2.String(), v.String()),
+			vType: Boolean,
 		}
+	case Nil:
+		return falseValue
 	}
 	return Value{
-		val:   f - f2,
-		vType: Number,
+		val:   fmt.Sprintf("can not check membership in %s value", v2.vType),
+		vType: Error,
 	}
 }
 
-func (v Value) Multi(v2 Value) Value {
-	f, err := v.Float()
-	if err != nil {
-		return Value{
-			val:   err.Error(),
-			vType: Error,
-		}
+func (v Value) NotIn(v2 Value) Value {
+	return v.In(v2).Not()
+}
+
+// Add 计算 v + v2, 有一边是不能解析成数字的字符串时拼接字符串, 数字和布尔值转换成文本, nil, 列表和对象不能拼接;
+// 否则按数字相加, 与 - * / 一样, "42" + 1 的结果是 43
+func (v Value) Add(v2 Value) Value {
+	if err := firstError(v, v2); err.vType == Error {
+		return err
 	}
-	f2, err := v2.Float()
-	if err != nil {
-		return Value{
-			val:   err.Error(),
-			vType: Error,
-		}
+	if isTemporal(v, v2) {
+		return temporalArith('+', v, v2)
 	}
-	return Value{
-		val:   f * f2,
-		vType: Number,
+	if isText(v) || isText(v2) {
+		return v.concat(v2)
 	}
+	return arith('+', v, v2)
 }
 
-func (v Value) Div(v2 Value) Value {
-	f, err := v.Float()
-	if err != nil {
-		return Value{
-			val:   err.Error(),
-			vType: Error,
-		}
+// isText 判断 v 是否是不能解析成数字的字符串
+func isText(v Value) bool {
+	if v.vType != String {
+		return false
 	}
-	f2, err := v2.Float()
-	if err != nil {
-		return Value{
-			val:   err.Error(),
-			vType: Error,
+	_, err := parseNumber(v.val.(string))
+	return err != nil
+}
+
+func (v Value) concat(v2 Value) Value {
+	s := make([]string, 2)
+	for i, item := range []Value{v, v2} {
+		switch item.vType {
+		case String, Boolean:
+			s[i] = item.String()
+		case Number:
+			s[i] = formatNumber(item.val)
+		default:
+			if item.name == "" {
+				return errorValue(errors.Errorf("can not concatenate %s value with string", item.vType))
+			}
+			return errorValue(errors.Errorf("variable '%s' is %s, can not concatenate with string", item.name, item.vType))
 		}
 	}
 	return Value{
-		val:   f / f2,
-		vType: Number,
+		val:   s[0] + s[1],
+		vType: String,
 	}
 }
 
-func (v Value) Mod(v2 Value) Value {
-	f, err := v.Float()
-	if err != nil {
-		return Value{
-			val:   err.Error(),
-			vType: Error,
-		}
-	}
-	f2, err := v2.Float()
-	if err != nil {
-		return Value{
-			val:   err.Error(),
-			vType: Error,
-		}
-	}
-	return Value{
-		val:   float64(int(f) % int(f2)),
-		vType: Number,
+func (v Value) Sub(v2 Value) Value {
+	if isTemporal(v, v2) {
+		return temporalArith('-', v, v2)
 	}
+	return arith('-', v, v2)
 }
 
-func compileRegexp(s string) (*regexp.Regexp, error) {
-	v, ok := recache.Load(s)
-	if ok {
-		return v.(*regexp.Regexp), nil
+func (v Value) Multi(v2 Value) Value {
+	if isTemporal(v, v2) {
+		return temporalArith('*', v, v2)
 	}
-	exp, err := regexp.Compile(s)
-	if err != nil {
-		return nil, err
+	return arith('*', v, v2)
+}
+
+func (v Value) Div(v2 Value) Value {
+	if isTemporal(v, v2) {
+		return temporalArith('/', v, v2)
 	}
-	recache.Store(s, exp)
-	return exp, nil
+	return arith('/', v, v2)
+}
+
+func (v Value) Mod(v2 Value) Value {
+	return arith('%', v, v2)
 }
@@ -1,38 +1,54 @@
+// Code generated by goyacc -o yacc.go yacc.y. DO NOT EDIT.
+
 //line yacc.y:2
+
 package assert
 
 import __yyfmt__ "fmt"
 
 //line yacc.y:3
+
 //line yacc.y:7
 type yySymType struct {
 	yys   int
-	value Value
+	node  node
+	nodes []node
 	op    string
+	pos   int
 }
 
 const VALUE = 57346
-const AND = 57347
-const OR = 57348
-const NOT = 57349
-const LB = 57350
-const RB = 57351
-const E = 57352
-const NE = 57353
-const RE = 57354
-const NRE = 57355
-const LT = 57356
-const GT = 57357
-const LTE = 57358
-const GTE = 57359
-const EOF = 57360
-const MATCH = 57361
+const FUNC = 57347
+const FIELD = 57348
+const AND = 57349
+const OR = 57350
+const NOT = 57351
+const LB = 57352
+const RB = 57353
+const E = 57354
+const NE = 57355
+const RE = 57356
+const NRE = 57357
+const LT = 57358
+const GT = 57359
+const LTE = 57360
+const GTE = 57361
+const IN = 57362
+const NOTIN = 57363
+const IMATCH = 57364
+const INCIDR = 57365
+const NOTINCIDR = 57366
+const COALESCE = 57367
+const EOF = 57368
+const MATCH = 57369
 
 var yyToknames = [...]string{
 	"$end",
 	"error",
 	"$unk",
 	"VALUE",
+	"FUNC",
+	"FIELD",
 	"AND",
 	"OR",
 	"NOT",
@@ -46,24 +62,36 @@ var yyToknames = [...]string{
 	"GT",
 	"LTE",
 	"GTE",
+	"IN",
+	"NOTIN",
+	"IMATCH",
+	"INCIDR",
+	"NOTINCIDR",
+	"COALESCE",
 	"EOF",
+	"'?'",
+	"':'",
 	"MATCH",
 	"'+'",
 	"'-'",
 	"'*'",
 	"'/'",
 	"'%'",
+	"'['",
+	"']'",
+	"','",
 }
+
 var yyStatenames = [...]string{}
 
 const yyEofCode = 1
 const yyErrCode = 2
 const yyInitialStackSize = 16
 
-//line yacc.y:129
+//line yacc.y:205
 
 //line yacctab:1
-var yyExca = [...]int{
+var yyExca = [...]int8{
 	-1, 1,
 	1, -1,
 	-2, 0,
@@ -71,78 +99,115 @@ var yyExca = [...]int{
 
 const yyPrivate = 57344
 
-const yyLast = 123
-
-var yyAct = [...]int{
-
-	2, 21, 22, 23, 24, 25, 26, 1, 0, 27,
-	28, 29, 30, 31, 32, 33, 34, 35, 36, 37,
-	38, 39, 40, 41, 42, 8, 9, 0, 0, 43,
-	10, 13, 11, 12, 14, 15, 16, 17, 0, 18,
-	19, 20, 21, 22, 23, 8, 9, 0, 0, 0,
-	10, 13, 11, 12, 14, 15, 16, 17, 7, 18,
-	19, 20, 21, 22, 23, 8, 0, 0, 0, 0,
-	10, 13, 11, 12, 14, 15, 16, 17, 0, 18,
-	19, 20, 21, 22, 23, 10, 13, 11, 12, 14,
-	15, 16, 17, 0, 18, 19, 20, 21, 22, 23,
-	19, 20, 21, 22, 23, 6, 0, 0, 4, 3,
-	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-	0, 0, 5,
+const yyLast = 328
+
+var yyAct = [...]int8{
+	41, 2, 69, 70, 35, 36, 37, 38, 1, 34,
+	0, 42, 43, 44, 45, 46, 47, 48, 49, 50,
+	51, 52, 53, 54, 55, 56, 57, 58, 59, 60,
+	61, 62, 63, 64, 65, 34, 12, 13, 33, 0,
+	0, 14, 17, 15, 16, 18, 19, 20, 21, 26,
+	27, 23, 24, 25, 11, 0, 10, 0, 22, 28,
+	29, 30, 31, 32, 33, 72, 0, 34, 12, 13,
+	0, 74, 75, 14, 17, 15, 16, 18, 19, 20,
+	21, 26, 27, 23, 24, 25, 11, 0, 10, 71,
+	22, 28, 29, 30, 31, 32, 33, 34, 12, 13,
+	0, 0, 66, 14, 17, 15, 16, 18, 19, 20,
+	21, 26, 27, 23, 24, 25, 11, 0, 10, 0,
+	22, 28, 29, 30, 31, 32, 33, 34, 12, 13,
+	0, 0, 0, 14, 17, 15, 16, 18, 19, 20,
+	21, 26, 27, 23, 24, 25, 11, 9, 10, 0,
+	22, 28, 29, 30, 31, 32, 33, 34, 12, 13,
+	0, 0, 0, 14, 17, 15, 16, 18, 19, 20,
+	21, 26, 27, 23, 24, 25, 11, 0, 10, 0,
+	22, 28, 29, 30, 31, 32, 33, 34, 12, 13,
+	0, 0, 0, 14, 17, 15, 16, 18, 19, 20,
+	21, 26, 27, 23, 24, 25, 11, 0, 0, 0,
+	22, 28, 29, 30, 31, 32, 33, 34, 12, 0,
+	0, 0, 34, 14, 17, 15, 16, 18, 19, 20,
+	21, 26, 27, 23, 24, 25, 0, 0, 0, 0,
+	22, 28, 29, 30, 31, 32, 33, 34, 30, 31,
+	32, 33, 0, 14, 17, 15, 16, 18, 19, 20,
+	21, 26, 27, 23, 24, 25, 34, 0, 40, 0,
+	22, 28, 29, 30, 31, 32, 33, 8, 6, 8,
+	6, 0, 4, 3, 4, 3, 67, 73, 0, 0,
+	28, 29, 30, 31, 32, 33, 8, 6, 0, 0,
+	0, 4, 3, 0, 5, 0, 5, 68, 7, 39,
+	7, 0, 0, 70, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 5, 0, 0, 0, 7,
 }
-var yyPact = [...]int{
 
-	101, -1000, 40, 101, 101, 101, -1000, -1000, 101, 101,
-	101, 101, 101, 101, 101, 101, 101, 101, 101, 101,
-	101, 101, 101, 101, 20, -1000, -21, 75, 60, 80,
-	80, 80, 80, 80, 80, 80, 80, 80, -21, -21,
-	-1000, -1000, -1000, -1000,
+var yyPact = [...]int16{
+	292, -1000, 121, 292, 292, 292, -3, 273, -1000, -1000,
+	292, 292, 292, 292, 292, 292, 292, 292, 292, 292,
+	292, 292, 292, 292, 292, 292, 292, 292, 292, 292,
+	292, 292, 292, 292, -1000, 91, 3, 216, 275, -1000,
+	-34, 151, 61, 181, 241, 211, 260, 260, 260, 260,
+	260, 260, 260, 260, 260, 260, 260, 260, 260, 260,
+	216, 216, 3, 3, 3, 29, -1000, -1000, 276, -1000,
+	292, 292, -1000, -1000, 151, 151,
 }
-var yyPgo = [...]int{
 
-	0, 7, 0,
+var yyPgo = [...]int16{
+	0, 8, 0, 268,
 }
-var yyR1 = [...]int{
 
+var yyR1 = [...]int8{
 	0, 1, 2, 2, 2, 2, 2, 2, 2, 2,
 	2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
-	2, 2,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	2, 2, 2, 2, 2, 3, 3,
 }
-var yyR2 = [...]int{
 
-	0, 2, 3, 2, 3, 3, 3, 3, 3, 3,
+var yyR2 = [...]int8{
+	0, 2, 3, 2, 5, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	2, 1,
+	3, 3, 3, 3, 3, 3, 3, 2, 3, 4,
+	2, 3, 4, 2, 1, 1, 3,
 }
-var yyChk = [...]int{
 
-	-1000, -1, -2, 8, 7, 21, 4, 18, 5, 6,
-	10, 12, 13, 11, 14, 15, 16, 17, 19, 20,
-	21, 22, 23, 24, -2, -2, -2, -2, -2, -2,
+var yyChk = [...]int16{
+	-1000, -1, -2, 10, 9, 31, 5, 35, 4, 26,
+	27, 25, 7, 8, 12, 14, 15, 13, 16, 17,
+	18, 19, 29, 22, 23, 24, 20, 21, 30, 31,
+	32, 33, 34, 35, 6, -2, -2, -2, 10, 36,
+	-3, -2, -2, -2, -2, -2, -2, -2, -2, -2,
 	-2, -2, -2, -2, -2, -2, -2, -2, -2, -2,
-	-2, -2, -2, 9,
+	-2, -2, -2, -2, -2, -2, 11, 11, -3, 36,
+	37, 28, 36, 11, -2, -2,
 }
-var yyDef = [...]int{
 
-	0, -2, 0, 0, 0, 0, 21, 1, 0, 0,
+var yyDef = [...]int8{
+	0, -2, 0, 0, 0, 0, 0, 0, 34, 1,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
 	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-	0, 0, 0, 0, 0, 3, 20, 4, 5, 6,
-	7, 8, 9, 10, 11, 12, 13, 14, 15, 16,
-	17, 18, 19, 2,
+	0, 0, 0, 0, 33, 0, 3, 27, 0, 30,
+	0, 35, 0, 5, 6, 7, 8, 9, 10, 11,
+	12, 13, 14, 15, 16, 17, 18, 19, 20, 21,
+	22, 23, 24, 25, 26, 0, 2, 28, 0, 31,
+	0, 0, 32, 29, 36, 4,
 }
-var yyTok1 = [...]int{
 
+var yyTok1 = [...]int8{
 	1, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 3, 3, 3, 3, 3, 3, 24, 3, 3,
-	3, 3, 22, 20, 3, 21, 3, 23,
+	3, 3, 3, 3, 3, 3, 3, 34, 3, 3,
+	3, 3, 32, 30, 37, 31, 3, 33, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 28, 3,
+	3, 3, 3, 27, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 35, 3, 36,
 }
-var yyTok2 = [...]int{
 
+var yyTok2 = [...]int8{
 	2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
-	12, 13, 14, 15, 16, 17, 18, 19,
+	12, 13, 14, 15, 16, 17, 18, 19, 20, 21,
+	22, 23, 24, 25, 26, 29,
 }
-var yyTok3 = [...]int{
+
+var yyTok3 = [...]int8{
 	0,
 }
 
@@ -224,9 +289,9 @@ func yyErrorMessage(state, lookAhead int) string {
 	expected := make([]int, 0, 4)
 
 	// Look for shiftable tokens.
-	base := yyPact[state]
+	base := int(yyPact[state])
 	for tok := TOKSTART; tok-1 < len(yyToknames); tok++ {
-		if n := base + tok; n >= 0 && n < yyLast && yyChk[yyAct[n]] == tok {
+		if n := base + tok; n >= 0 && n < yyLast && int(yyChk[int(yyAct[n])]) == tok {
 			if len(expected) == cap(expected) {
 				return res
 			}
@@ -236,13 +301,13 @@ func yyErrorMessage(state, lookAhead int) string {
 
 	if yyDef[state] == -2 {
 		i := 0
-		for yyExca[i] != -1 || yyExca[i+1] != state {
+		for yyExca[i] != -1 || int(yyExca[i+1]) != state {
 			i += 2
 		}
 
 		// Look for tokens that we accept or reduce.
 		for i += 2; yyExca[i] >= 0; i += 2 {
-			tok := yyExca[i]
+			tok := int(yyExca[i])
 			if tok < TOKSTART || yyExca[i+1] == 0 {
 				continue
 			}
@@ -273,30 +338,30 @@ func yylex1(lex yyLexer, lval *yySymType) (char, token int) {
 	token = 0
 	char = lex.Lex(lval)
 	if char <= 0 {
-		token = yyTok1[0]
+		token = int(yyTok1[0])
 		goto out
 	}
 	if char < len(yyTok1) {
-		token = yyTok1[char]
+		token = int(yyTok1[char])
 		goto out
 	}
 	if char >= yyPrivate {
 		if char < yyPrivate+len(yyTok2) {
-			token = yyTok2[char-yyPrivate]
+			token = int(yyTok2[char-yyPrivate])
 			goto out
 		}
 	}
 	for i := 0; i < len(yyTok3); i += 2 {
-		token = yyTok3[i+0]
+		token = int(yyTok3[i+0])
 		if token == char {
-			token = yyTok3[i+1]
+			token = int(yyTok3[i+1])
 			goto out
 		}
 	}
 
 out:
 	if token == 0 {
-		token = yyTok2[1] /* unknown char */
+		token = int(yyTok2[1]) /* unknown char */
 	}
 	if yyDebug >= 3 {
 		__yyfmt__.Printf("lex %s(%d)\n", yyTokname(token), uint(char))
@@ -351,7 +416,7 @@ yystack:
 	yyS[yyp].yys = yystate
 
 yynewstate:
-	yyn = yyPact[yystate]
+	yyn = int(yyPact[yystate])
 	if yyn <= yyFlag {
 		goto yydefault /* simple state */
 	}
@@ -362,8 +427,8 @@ yynewstate:
 	if yyn < 0 || yyn >= yyLast {
 		goto yydefault
 	}
-	yyn = yyAct[yyn]
-	if yyChk[yyn] == yytoken { /* valid shift */
+	yyn = int(yyAct[yyn])
+	if int(yyChk[yyn]) == yytoken { /* valid shift */
 		yyrcvr.char = -1
 		yytoken = -1
 		yyVAL = yyrcvr.lval
@@ -376,7 +441,7 @@ yynewstate:
 
 yydefault:
 	/* default state action */
-	yyn = yyDef[yystate]
+	yyn = int(yyDef[yystate])
 	if yyn == -2 {
 		if yyrcvr.char < 0 {
 			yyrcvr.char, yytoken = yylex1(yylex, &yyrcvr.lval)
@@ -385,18 +450,18 @@ yydefault:
 		/* look through exception table */
 		xi := 0
 		for {
-			if yyExca[xi+0] == -1 && yyExca[xi+1] == yystate {
+			if yyExca[xi+0] == -1 && int(yyExca[xi+1]) == yystate {
 				break
 			}
 			xi += 2
 		}
 		for xi += 2; ; xi += 2 {
-			yyn = yyExca[xi+0]
+			yyn = int(yyExca[xi+0])
 			if yyn < 0 || yyn == yytoken {
 				break
 			}
 		}
-		yyn = yyExca[xi+1]
+		yyn = int(yyExca[xi+1])
 		if yyn < 0 {
 			goto ret0
 		}
@@ -418,10 +483,10 @@ yydefault:
 
 			/* find a state where "error" is a legal shift action */
 			for yyp >= 0 {
-				yyn = yyPact[yyS[yyp].yys] + yyErrCode
+				yyn = int(yyPact[yyS[yyp].yys]) + yyErrCode
 				if yyn >= 0 && yyn < yyLast {
-					yystate = yyAct[yyn] /* simulate a shift of "error" */
-					if yyChk[yystate] == yyErrCode {
+					yystate = int(yyAct[yyn]) /* simulate a shift of "error" */
+					if int(yyChk[yystate]) == yyErrCode {
 						goto yystack
 					}
 				}
@@ -457,7 +522,7 @@ yydefault:
 	yypt := yyp
 	_ = yypt // guard against "declared and not used"
 
-	yyp -= yyR2[yyn]
+	yyp -= int(yyR2[yyn])
 	// yyp is now the index of $0. Perform the default action. Iff the
 	// reduced production is ε, $1 is possibly out of range.
 	if yyp+1 >= len(yyS) {
@@ -468,16 +533,16 @@ yydefault:
 	yyVAL = yyS[yyp+1]
 
 	/* consult goto table to find next state */
-	yyn = yyR1[yyn]
-	yyg := yyPgo[yyn]
+	yyn = int(yyR1[yyn])
+	yyg := int(yyPgo[yyn])
 	yyj := yyg + yyS[yyp].yys + 1
 
 	if yyj >= yyLast {
-		yystate = yyAct[yyg]
+		yystate = int(yyAct[yyg])
 	} else {
-		yystate = yyAct[yyj]
-		if yyChk[yystate] != -yyn {
-			yystate = yyAct[yyg]
+		yystate = int(yyAct[yyj])
+		if int(yyChk[yystate]) != -yyn {
+			yystate = int(yyAct[yyg])
 		}
 	}
 	// dummy call; replaced with literal code
@@ -485,131 +550,221 @@ yydefault:
 
 	case 1:
 		yyDollar = yyS[yypt-2 : yypt+1]
-		//line yacc.y:42
+//line yacc.y:56
 		{
-			yylex.(*Assert).answer = yyDollar[1].value
-			yyVAL.value = yyDollar[1].value
+			yylex.(*lexer).root = yyDollar[1].node
+			yyVAL.node = yyDollar[1].node
 			return 0
 		}
 	case 2:
 		yyDollar = yyS[yypt-3 : yypt+1]
-		//line yacc.y:49
+//line yacc.y:63
 		{
-			yyVAL.value = yyDollar[2].value
+			yyVAL.node = yyDollar[2].node
 		}
 	case 3:
 		yyDollar = yyS[yypt-2 : yypt+1]
-		//line yacc.y:53
+//line yacc.y:67
 		{
-			yyVAL.value = yyDollar[2].value.Not()
+			yyVAL.node = &unaryNode{pos: pos(yyDollar[1].pos), op: NOT, x: yyDollar[2].node}
 		}
 	case 4:
-		yyDollar = yyS[yypt-3 : yypt+1]
-		//line yacc.y:57
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line yacc.y:71
 		{
-			yyVAL.value = yyDollar[1].value.And(yyDollar[3].value)
+			yyVAL.node = &ternaryNode{pos: pos(yyDollar[2].pos), cond: yyDollar[1].node, yes: yyDollar[3].node, no: yyDollar[5].node}
 		}
 	case 5:
 		yyDollar = yyS[yypt-3 : yypt+1]
-		//line yacc.y:61
+//line yacc.y:75
 		{
-			yyVAL.value = yyDollar[1].value.Or(yyDollar[3].value)
+			yyVAL.node = &binaryNode{pos: pos(yyDollar[2].pos), op: COALESCE, left: yyDollar[1].node, right: yyDollar[3].node}
 		}
 	case 6:
 		yyDollar = yyS[yypt-3 : yypt+1]
-		//line yacc.y:65
+//line yacc.y:79
 		{
-			yyVAL.value = yyDollar[1].value.E(yyDollar[3].value)
+			yyVAL.node = &binaryNode{pos: pos(yyDollar[2].pos), op: AND, left: yyDollar[1].node, right: yyDollar[3].node}
 		}
 	case 7:
 		yyDollar = yyS[yypt-3 : yypt+1]
-		//line yacc.y:69
+//line yacc.y:83
 		{
-			yyVAL.value = yyDollar[1].value.RE(yyDollar[3].value)
+			yyVAL.node = &binaryNode{pos: pos(yyDollar[2].pos), op: OR, left: yyDollar[1].node, right: yyDollar[3].node}
 		}
 	case 8:
 		yyDollar = yyS[yypt-3 : yypt+1]
-		//line yacc.y:73
+//line yacc.y:87
 		{
-			yyVAL.value = yyDollar[1].value.NRE(yyDollar[3].value)
+			yyVAL.node = &binaryNode{pos: pos(yyDollar[2].pos), op: E, left: yyDollar[1].node, right: yyDollar[3].node}
 		}
 	case 9:
 		yyDollar = yyS[yypt-3 : yypt+1]
-		//line yacc.y:77
+//line yacc.y:91
 		{
-			yyVAL.value = yyDollar[1].value.NE(yyDollar[3].value)
+			yyVAL.node = &binaryNode{pos: pos(yyDollar[2].pos), op: RE, left: yyDollar[1].node, right: yyDollar[3].node}
 		}
 	case 10:
 		yyDollar = yyS[yypt-3 : yypt+1]
-		//line yacc.y:81
+//line yacc.y:95
 		{
-			yyVAL.value = yyDollar[1].value.LT(yyDollar[3].value)
+			yyVAL.node = &binaryNode{pos: pos(yyDollar[2].pos), op: NRE, left: yyDollar[1].node, right: yyDollar[3].node}
 		}
 	case 11:
 		yyDollar = yyS[yypt-3 : yypt+1]
-		//line yacc.y:85
+//line yacc.y:99
 		{
-			yyVAL.value = yyDollar[1].value.GT(yyDollar[3].value)
+			yyVAL.node = &binaryNode{pos: pos(yyDollar[2].pos), op: NE, left: yyDollar[1].node, right: yyDollar[3].node}
 		}
 	case 12:
 		yyDollar = yyS[yypt-3 : yypt+1]
-		//line yacc.y:89
+//line yacc.y:103
 		{
-			yyVAL.value = yyDollar[1].value.LTE(yyDollar[3].value)
+			yyVAL.node = &binaryNode{pos: pos(yyDollar[2].pos), op: LT, left: yyDollar[1].node, right: yyDollar[3].node}
 		}
 	case 13:
 		yyDollar = yyS[yypt-3 : yypt+1]
-		//line yacc.y:93
+//line yacc.y:107
 		{
-			yyVAL.value = yyDollar[1].value.GTE(yyDollar[3].value)
+			yyVAL.node = &binaryNode{pos: pos(yyDollar[2].pos), op: GT, left: yyDollar[1].node, right: yyDollar[3].node}
 		}
 	case 14:
 		yyDollar = yyS[yypt-3 : yypt+1]
-		//line yacc.y:97
+//line yacc.y:111
 		{
-			yyVAL.value = yyDollar[1].value.MATCH(yyDollar[3].value)
+			yyVAL.node = &binaryNode{pos: pos(yyDollar[2].pos), op: LTE, left: yyDollar[1].node, right: yyDollar[3].node}
 		}
 	case 15:
 		yyDollar = yyS[yypt-3 : yypt+1]
-		//line yacc.y:101
+//line yacc.y:115
 		{
-			yyVAL.value = yyDollar[1].value.Add(yyDollar[3].value)
+			yyVAL.node = &binaryNode{pos: pos(yyDollar[2].pos), op: GTE, left: yyDollar[1].node, right: yyDollar[3].node}
 		}
 	case 16:
 		yyDollar = yyS[yypt-3 : yypt+1]
-		//line yacc.y:105
+//line yacc.y:119
 		{
-			yyVAL.value = yyDollar[1].value.Sub(yyDollar[3].value)
+			yyVAL.node = &binaryNode{pos: pos(yyDollar[2].pos), op: MATCH, left: yyDollar[1].node, right: yyDollar[3].node}
 		}
 	case 17:
 		yyDollar = yyS[yypt-3 : yypt+1]
-		//line yacc.y:109
+//line yacc.y:123
 		{
-			yyVAL.value = yyDollar[1].value.Multi(yyDollar[3].value)
+			yyVAL.node = &binaryNode{pos: pos(yyDollar[2].pos), op: IMATCH, left: yyDollar[1].node, right: yyDollar[3].node}
 		}
 	case 18:
 		yyDollar = yyS[yypt-3 : yypt+1]
-		//line yacc.y:113
+//line yacc.y:127
 		{
-			yyVAL.value = yyDollar[1].value.Div(yyDollar[3].value)
+			yyVAL.node = &binaryNode{pos: pos(yyDollar[2].pos), op: INCIDR, left: yyDollar[1].node, right: yyDollar[3].node}
 		}
 	case 19:
 		yyDollar = yyS[yypt-3 : yypt+1]
-		//line yacc.y:117
+//line yacc.y:131
 		{
-			yyVAL.value = yyDollar[1].value.Mod(yyDollar[3].value)
+			yyVAL.node = &binaryNode{pos: pos(yyDollar[2].pos), op: NOTINCIDR, left: yyDollar[1].node, right: yyDollar[3].node}
 		}
 	case 20:
-		yyDollar = yyS[yypt-2 : yypt+1]
-		//line yacc.y:121
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yacc.y:135
 		{
-			yyVAL.value = NewValue("", 0).Sub(yyDollar[2].value)
+			yyVAL.node = &binaryNode{pos: pos(yyDollar[2].pos), op: IN, left: yyDollar[1].node, right: yyDollar[3].node}
 		}
 	case 21:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yacc.y:139
+		{
+			yyVAL.node = &binaryNode{pos: pos(yyDollar[2].pos), op: NOTIN, left: yyDollar[1].node, right: yyDollar[3].node}
+		}
+	case 22:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yacc.y:143
+		{
+			yyVAL.node = &binaryNode{pos: pos(yyDollar[2].pos), op: '+', left: yyDollar[1].node, right: yyDollar[3].node}
+		}
+	case 23:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yacc.y:147
+		{
+			yyVAL.node = &binaryNode{pos: pos(yyDollar[2].pos), op: '-', left: yyDollar[1].node, right: yyDollar[3].node}
+		}
+	case 24:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yacc.y:151
+		{
+			yyVAL.node = &binaryNode{pos: pos(yyDollar[2].pos), op: '*', left: yyDollar[1].node, right: yyDollar[3].node}
+		}
+	case 25:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yacc.y:155
+		{
+			yyVAL.node = &binaryNode{pos: pos(yyDollar[2].pos), op: '/', left: yyDollar[1].node, right: yyDollar[3].node}
+		}
+	case 26:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yacc.y:159
+		{
+			yyVAL.node = &binaryNode{pos: pos(yyDollar[2].pos), op: '%', left: yyDollar[1].node, right: yyDollar[3].node}
+		}
+	case 27:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line yacc.y:163
+		{
+			yyVAL.node = &unaryNode{pos: pos(yyDollar[1].pos), op: '-', x: yyDollar[2].node}
+		}
+	case 28:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yacc.y:167
+		{
+			yyVAL.node = &callNode{pos: pos(yyDollar[1].pos), name: yyDollar[1].op}
+		}
+	case 29:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line yacc.y:171
+		{
+			yyVAL.node = &callNode{pos: pos(yyDollar[1].pos), name: yyDollar[1].op, args: yyDollar[3].nodes}
+		}
+	case 30:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line yacc.y:175
+		{
+			yyVAL.node = &listNode{pos: pos(yyDollar[1].pos)}
+		}
+	case 31:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yacc.y:179
+		{
+			yyVAL.node = &listNode{pos: pos(yyDollar[1].pos), items: yyDollar[2].nodes}
+		}
+	case 32:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line yacc.y:183
+		{
+			yyVAL.node = &indexNode{pos: pos(yyDollar[2].pos), x: yyDollar[1].node, index: yyDollar[3].node}
+		}
+	case 33:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line yacc.y:187
+		{
+			yyVAL.node = newFieldNode(yyDollar[2].pos, yyDollar[1].node, yyDollar[2].op)
+		}
+	case 34:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line yacc.y:191
+		{
+			yyVAL.node = yyDollar[1].node
+		}
+	case 35:
 		yyDollar = yyS[yypt-1 : yypt+1]
-		//line yacc.y:125
+//line yacc.y:197
+		{
+			yyVAL.nodes = []node{yyDollar[1].node}
+		}
+	case 36:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yacc.y:201
 		{
-			yyVAL.value = yyDollar[1].value
+			yyVAL.nodes = append(yyDollar[1].nodes, yyDollar[3].node)
 		}
 	}
 	goto yystack /* stack new state and value */
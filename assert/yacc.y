@@ -5,14 +5,19 @@ package assert
 %}
 
 %union {
-    value Value
+    node node
+    nodes []node
     op string
+    pos int
 }
 
 
-%type <value> statement expr
+%type <node> statement expr
+%type <nodes> args
 
-%token <value> VALUE
+%token <node> VALUE
+%token <op> FUNC
+%token <op> FIELD
 %token AND
 %token OR
 %token NOT
@@ -26,21 +31,30 @@ package assert
 %token GT
 %token LTE
 %token GTE
+%token IN
+%token NOTIN
+%token IMATCH
+%token INCIDR
+%token NOTINCIDR
+%token COALESCE
 %token EOF
 
 %left EOF
+%right '?' ':'
+%right COALESCE
 %left OR
 %left AND
-%left E NE LT GT LTE GTE RE NRE MATCH
+%left E NE LT GT LTE GTE RE NRE MATCH IMATCH IN NOTIN INCIDR NOTINCIDR
 %left '+' '-'
 %left '*' '/' '%'
 %left LB RB
 %right NOT
+%left '[' FIELD
 %%
 
 statement: expr EOF
     {
-        yylex.(*Assert).answer = $1
+        yylex.(*lexer).root = $1
         $$ = $1
         return 0
     }
@@ -51,79 +65,141 @@ expr: LB expr RB
     }
     | NOT expr 
     {
-        $$ = $2.Not()
+        $$ = &unaryNode{pos: pos($<pos>1), op: NOT, x: $2}
+    }
+    | expr '?' expr ':' expr
+    {
+        $$ = &ternaryNode{pos: pos($<pos>2), cond: $1, yes: $3, no: $5}
+    }
+    | expr COALESCE expr
+    {
+        $$ = &binaryNode{pos: pos($<pos>2), op: COALESCE, left: $1, right: $3}
     }
     | expr AND expr 
     {
-        $$ = $1.And($3)
+        $$ = &binaryNode{pos: pos($<pos>2), op: AND, left: $1, right: $3}
     }
     | expr OR expr 
     {
-        $$ = $1.Or($3)
+        $$ = &binaryNode{pos: pos($<pos>2), op: OR, left: $1, right: $3}
     }
     | expr E expr
     { 
-        $$ = $1.E($3)
+        $$ = &binaryNode{pos: pos($<pos>2), op: E, left: $1, right: $3}
     }
     | expr RE expr
     {
-        $$ = $1.RE($3)
+        $$ = &binaryNode{pos: pos($<pos>2), op: RE, left: $1, right: $3}
     }
     | expr NRE expr
     {
-        $$ = $1.NRE($3)
+        $$ = &binaryNode{pos: pos($<pos>2), op: NRE, left: $1, right: $3}
     }
     | expr NE expr
     { 
-        $$ = $1.NE($3) 
+        $$ = &binaryNode{pos: pos($<pos>2), op: NE, left: $1, right: $3}
     }
     | expr LT expr
     {
-        $$ = $1.LT($3)
+        $$ = &binaryNode{pos: pos($<pos>2), op: LT, left: $1, right: $3}
     }
     | expr GT expr
     { 
-        $$ = $1.GT($3)
+        $$ = &binaryNode{pos: pos($<pos>2), op: GT, left: $1, right: $3}
     }
     | expr LTE expr
     {
-        $$ = $1.LTE($3)        
+        $$ = &binaryNode{pos: pos($<pos>2), op: LTE, left: $1, right: $3}
     }
     | expr GTE expr
     { 
-        $$ = $1.GTE($3)                
+        $$ = &binaryNode{pos: pos($<pos>2), op: GTE, left: $1, right: $3}
     }
     | expr MATCH expr
     {
-        $$ = $1.MATCH($3)
+        $$ = &binaryNode{pos: pos($<pos>2), op: MATCH, left: $1, right: $3}
+    }
+    | expr IMATCH expr
+    {
+        $$ = &binaryNode{pos: pos($<pos>2), op: IMATCH, left: $1, right: $3}
+    }
+    | expr INCIDR expr
+    {
+        $$ = &binaryNode{pos: pos($<pos>2), op: INCIDR, left: $1, right: $3}
+    }
+    | expr NOTINCIDR expr
+    {
+        $$ = &binaryNode{pos: pos($<pos>2), op: NOTINCIDR, left: $1, right: $3}
+    }
+    | expr IN expr
+    {
+        $$ = &binaryNode{pos: pos($<pos>2), op: IN, left: $1, right: $3}
+    }
+    | expr NOTIN expr
+    {
+        $$ = &binaryNode{pos: pos($<pos>2), op: NOTIN, left: $1, right: $3}
     }
     | expr '+' expr
     { 
-        $$ = $1.Add($3) 
+        $$ = &binaryNode{pos: pos($<pos>2), op: '+', left: $1, right: $3}
     }
 	| expr '-' expr
     { 
-        $$ = $1.Sub($3)
+        $$ = &binaryNode{pos: pos($<pos>2), op: '-', left: $1, right: $3}
     }
 	| expr '*' expr
     {
-        $$ = $1.Multi($3)
+        $$ = &binaryNode{pos: pos($<pos>2), op: '*', left: $1, right: $3}
     }
 	| expr '/' expr
     {
-        $$ = $1.Div($3)
+        $$ = &binaryNode{pos: pos($<pos>2), op: '/', left: $1, right: $3}
     }
 	| expr '%' expr
     {
-        $$ = $1.Mod($3)
+        $$ = &binaryNode{pos: pos($<pos>2), op: '%', left: $1, right: $3}
     }
     | '-' expr
     {
-        $$ = NewValue("", 0).Sub($2)
+        $$ = &unaryNode{pos: pos($<pos>1), op: '-', x: $2}
+    }
+    | FUNC LB RB
+    {
+        $$ = &callNode{pos: pos($<pos>1), name: $1}
+    }
+    | FUNC LB args RB
+    {
+        $$ = &callNode{pos: pos($<pos>1), name: $1, args: $3}
+    }
+    | '[' ']'
+    {
+        $$ = &listNode{pos: pos($<pos>1)}
+    }
+    | '[' args ']'
+    {
+        $$ = &listNode{pos: pos($<pos>1), items: $2}
+    }
+    | expr '[' expr ']'
+    {
+        $$ = &indexNode{pos: pos($<pos>2), x: $1, index: $3}
+    }
+    | expr FIELD
+    {
+        $$ = newFieldNode($<pos>2, $1, $2)
     }
     | VALUE
     { 
         $$ = $1 
     }
     ;
+
+args: expr
+    {
+        $$ = []node{$1}
+    }
+    | args ',' expr
+    {
+        $$ = append($1, $3)
+    }
+    ;
 %%
\ No newline at end of file
@@ -0,0 +1,90 @@
+package influxdb_client
+
+import (
+	"strings"
+
+	influxmodels "github.com/influxdata/influxdb/models"
+)
+
+// PointKV 将 influxdb 的 point 包装成 assert.KV, 可以直接在 point 上执行规则:
+//
+//	measurement    point 的 measurement
+//	time           point 的时间
+//	tags, fields   所有的 tag (map[string]string) 或 field (map[string]interface{})
+//	tags.<key>     tag 的值
+//	fields.<key>   field 的值
+//	<key>          tag 的值, 没有这个 tag 时为 field 的值
+//
+// tag 和 field 在第一次读取时解析并保存, 所以 PointKV 不能在多个 goroutine 中共享
+type PointKV struct {
+	point      influxmodels.Point
+	tags       influxmodels.Tags
+	fields     influxmodels.Fields
+	tagsParsed bool
+	parsed     bool
+}
+
+// NewPointKV 将 point 包装成 assert.KV
+func NewPointKV(point influxmodels.Point) *PointKV {
+	return &PointKV{point: point}
+}
+
+// Get 实现 assert.KV
+func (kv *PointKV) Get(key string) interface{} {
+	switch key {
+	case "measurement":
+		return string(kv.point.Name())
+	case "time":
+		return kv.point.Time()
+	case "tags":
+		return kv.getTags().Map()
+	case "fields":
+		fields := kv.getFields()
+		if fields == nil {
+			return nil
+		}
+		return map[string]interface{}(fields)
+	}
+	if strings.HasPrefix(key, "tags.") {
+		return kv.tag(key[len("tags."):])
+	}
+	if strings.HasPrefix(key, "fields.") {
+		return kv.field(key[len("fields."):])
+	}
+	if v := kv.tag(key); v != nil {
+		return v
+	}
+	return kv.field(key)
+}
+
+func (kv *PointKV) tag(key string) interface{} {
+	v := kv.getTags().Get([]byte(key))
+	if v == nil {
+		return nil
+	}
+	return string(v)
+}
+
+func (kv *PointKV) field(key string) interface{} {
+	fields := kv.getFields()
+	if fields == nil {
+		return nil
+	}
+	return fields[key]
+}
+
+func (kv *PointKV) getTags() influxmodels.Tags {
+	if !kv.tagsParsed {
+		kv.tags = kv.point.Tags()
+		kv.tagsParsed = true
+	}
+	return kv.tags
+}
+
+func (kv *PointKV) getFields() influxmodels.Fields {
+	if !kv.parsed {
+		kv.fields, _ = kv.point.Fields()
+		kv.parsed = true
+	}
+	return kv.fields
+}
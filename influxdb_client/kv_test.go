@@ -0,0 +1,86 @@
+package influxdb_client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudfly/golang/assert"
+	influxmodels "github.com/influxdata/influxdb/models"
+)
+
+func newTestPoint(t testing.TB) influxmodels.Point {
+	point, err := influxmodels.NewPoint(
+		"http",
+		influxmodels.NewTags(map[string]string{"host": "web-1", "region": "bj"}),
+		influxmodels.Fields{"code": int64(503), "latency": 1.5, "host": "field-host"},
+		time.Unix(1600000000, 0),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return point
+}
+
+func TestPointKV(t *testing.T) {
+	kv := NewPointKV(newTestPoint(t))
+	for code, expect := range map[string]bool{
+		`measurement == "http"`:                          true,
+		`host == "web-1" && fields.host == "field-host"`: true,
+		`tags.region == "bj" && code >= 500`:             true,
+		`latency > 1 && fields.code == 503`:              true,
+		`missing == nil && tags.code == nil`:             true,
+		`time < "2021-01-01T00:00:00Z"`:                  true,
+	} {
+		ok, err := assert.Execute(code, kv)
+		if err != nil {
+			t.Fatalf("%s: %s", code, err)
+		}
+		if ok != expect {
+			t.Fatalf("%s: expect %v, got %v", code, expect, ok)
+		}
+	}
+}
+
+// countingPoint counts the calls of Tags
+type countingPoint struct {
+	influxmodels.Point
+	tagsCalls int
+}
+
+func (p *countingPoint) Tags() influxmodels.Tags {
+	p.tagsCalls++
+	return p.Point.Tags()
+}
+
+func TestPointKVParseOnce(t *testing.T) {
+	for _, tags := range []map[string]string{{"host": "web-1"}, nil} {
+		point, err := influxmodels.NewPoint("http", influxmodels.NewTags(tags), influxmodels.Fields{"code": int64(200)}, time.Unix(1600000000, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		counting := &countingPoint{Point: point}
+		kv := NewPointKV(counting)
+		for i := 0; i < 3; i++ {
+			kv.Get("host")
+			kv.Get("tags.region")
+			if m := kv.Get("tags").(map[string]string); len(m) != len(tags) {
+				t.Fatalf("expect %d tags, got %v", len(tags), m)
+			}
+		}
+		if counting.tagsCalls != 1 {
+			t.Fatalf("tags should be parsed once, got %d", counting.tagsCalls)
+		}
+	}
+}
+
+func BenchmarkPointKV(b *testing.B) {
+	point := newTestPoint(b)
+	expr, err := assert.New(`measurement == "http" && host == "web-1" && code >= 500`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		expr.Execute(NewPointKV(point))
+	}
+}
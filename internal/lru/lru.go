@@ -0,0 +1,115 @@
+// Package lru is the bounded cache shared by the regexp cache of assert and the template cache of template.
+package lru
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Stats is the statistics of Cache
+type Stats struct {
+	Size      int    `json:"size"`
+	Capacity  int    `json:"capacity"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+}
+
+// Cache keeps the values loaded by keys, the least recently used ones are evicted when it is full.
+// It is safe for concurrent use.
+type Cache struct {
+	mu        sync.Mutex
+	items     map[string]*list.Element
+	lru       *list.List // the most recently used is at front
+	capacity  int
+	hits      uint64
+	misses    uint64
+	evictions uint64
+	// generation is increased by Clear, a value loaded before Clear is not inserted
+	generation uint64
+}
+
+type entry struct {
+	key   string
+	value interface{}
+}
+
+// New create a cache holding at most capacity values, nothing is cached if capacity <= 0.
+func New(capacity int) *Cache {
+	return &Cache{
+		items:    make(map[string]*list.Element),
+		lru:      list.New(),
+		capacity: capacity,
+	}
+}
+
+// Get returns the value of key, it is loaded by load if not in cache. The load is called without lock,
+// so the same key may be loaded by several goroutines at the same time, and the first one is kept.
+// The error is not cached, and the value loaded across a Clear is returned but not cached.
+func (c *Cache) Get(key string, load func(string) (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+	if elem, ok := c.items[key]; ok {
+		c.hits++
+		c.lru.MoveToFront(elem)
+		c.mu.Unlock()
+		return elem.Value.(*entry).value, nil
+	}
+	c.misses++
+	generation := c.generation
+	c.mu.Unlock()
+
+	value, err := load(key)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[key]; ok { // loaded by other goroutine
+		return elem.Value.(*entry).value, nil
+	}
+	if c.capacity > 0 && c.generation == generation {
+		c.items[key] = c.lru.PushFront(&entry{key: key, value: value})
+		c.evict()
+	}
+	return value, nil
+}
+
+// Resize changes the capacity, the values out of capacity are evicted.
+func (c *Cache) Resize(capacity int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.capacity = capacity
+	c.evict()
+}
+
+// Clear removes all the values, the statistics are kept.
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.items = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+// Stats returns the statistics of cache
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{
+		Size:      c.lru.Len(),
+		Capacity:  c.capacity,
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+}
+
+func (c *Cache) evict() {
+	for c.lru.Len() > c.capacity && c.lru.Len() > 0 {
+		elem := c.lru.Back()
+		c.lru.Remove(elem)
+		delete(c.items, elem.Value.(*entry).key)
+		c.evictions++
+	}
+}
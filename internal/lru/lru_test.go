@@ -0,0 +1,64 @@
+package lru
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	loads := 0
+	load := func(key string) (interface{}, error) {
+		loads++
+		if key == "bad" {
+			return nil, errors.New("bad key")
+		}
+		return key + "!", nil
+	}
+
+	c := New(2)
+	for _, key := range []string{"a", "b", "a", "c", "b"} {
+		v, err := c.Get(key, load)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != key+"!" {
+			t.Fatalf("unexpected value %v for %s", v, key)
+		}
+	}
+	// b is evicted by c, since a is used recently
+	if stats := c.Stats(); stats != (Stats{Size: 2, Capacity: 2, Hits: 1, Misses: 4, Evictions: 2}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if loads != 4 {
+		t.Errorf("expect 4 loads, got %d", loads)
+	}
+
+	if _, err := c.Get("bad", load); err == nil {
+		t.Error("error should be returned")
+	}
+	if _, err := c.Get("bad", load); err == nil || loads != 6 {
+		t.Error("error should not be cached")
+	}
+
+	// the value loaded across a Clear is not cached
+	v, err := c.Get("x", func(key string) (interface{}, error) {
+		c.Clear()
+		return load(key)
+	})
+	if err != nil || v != "x!" {
+		t.Fatalf("unexpected result %v, %v", v, err)
+	}
+	if stats := c.Stats(); stats.Size != 0 {
+		t.Errorf("value loaded before Clear should not be cached, got %+v", stats)
+	}
+
+	c.Get("a", load)
+	c.Resize(0)
+	if stats := c.Stats(); stats.Size != 0 || stats.Capacity != 0 {
+		t.Errorf("cache should be empty, got %+v", stats)
+	}
+	c.Get("a", load)
+	if stats := c.Stats(); stats.Size != 0 {
+		t.Errorf("nothing should be cached, got %+v", stats)
+	}
+}
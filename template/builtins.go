@@ -0,0 +1,399 @@
+package template
+
+import (
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	errBadArithmeticType = errors.New("invalid type for arithmetic")
+	errDivideByZero      = errors.New("division by zero")
+	errOverflow          = errors.New("integer overflow")
+)
+
+// add returns a + b
+func add(a, b interface{}) (interface{}, error) {
+	return arithmetic('+', a, b)
+}
+
+// sub returns a - b
+func sub(a, b interface{}) (interface{}, error) {
+	return arithmetic('-', a, b)
+}
+
+// mul returns a * b
+func mul(a, b interface{}) (interface{}, error) {
+	return arithmetic('*', a, b)
+}
+
+// div returns a / b, it is integer division if both are integers
+func div(a, b interface{}) (interface{}, error) {
+	return arithmetic('/', a, b)
+}
+
+// mod returns a % b, math.Mod is used for floats
+func mod(a, b interface{}) (interface{}, error) {
+	return arithmetic('%', a, b)
+}
+
+// arithmetic computes the numbers in the way of basicKind. If both are the same type, the result is in the type,
+// otherwise integers are promoted to int64 or uint64, and any float makes the result float64.
+// The integer overflow is an error.
+func arithmetic(op byte, arg1, arg2 interface{}) (interface{}, error) {
+	v1, v2 := reflect.ValueOf(arg1), reflect.ValueOf(arg2)
+	k1, err := basicKind(v1)
+	if err != nil {
+		return nil, errBadArithmeticType
+	}
+	k2, err := basicKind(v2)
+	if err != nil {
+		return nil, errBadArithmeticType
+	}
+	for _, k := range []kind{k1, k2} {
+		if k != intKind && k != uintKind && k != floatKind {
+			return nil, errBadArithmeticType
+		}
+	}
+	var result reflect.Value
+	switch {
+	case k1 == floatKind || k2 == floatKind:
+		f, err := floatOp(op, toFloat64(v1, k1), toFloat64(v2, k2))
+		if err != nil {
+			return nil, err
+		}
+		result = reflect.ValueOf(f)
+	case k1 == uintKind && k2 == uintKind:
+		u, err := uintOp(op, v1.Uint(), v2.Uint())
+		if err != nil {
+			return nil, err
+		}
+		result = reflect.ValueOf(u)
+	default: // at least one is int
+		a, err := toInt64(v1, k1)
+		if err != nil {
+			return nil, err
+		}
+		b, err := toInt64(v2, k2)
+		if err != nil {
+			return nil, err
+		}
+		i, err := intOp(op, a, b)
+		if err != nil {
+			return nil, err
+		}
+		result = reflect.ValueOf(i)
+	}
+	if typ := v1.Type(); typ == v2.Type() && typ != result.Type() {
+		// keep the type of operands, such as int + int is int
+		switch {
+		case k1 == intKind && reflect.Zero(typ).OverflowInt(result.Int()),
+			k1 == uintKind && reflect.Zero(typ).OverflowUint(result.Uint()):
+			return nil, errOverflow
+		}
+		result = result.Convert(typ)
+	}
+	return result.Interface(), nil
+}
+
+func toFloat64(v reflect.Value, k kind) float64 {
+	switch k {
+	case intKind:
+		return float64(v.Int())
+	case uintKind:
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
+
+func toInt64(v reflect.Value, k kind) (int64, error) {
+	if k == uintKind {
+		if v.Uint() > math.MaxInt64 {
+			return 0, errOverflow
+		}
+		return int64(v.Uint()), nil
+	}
+	return v.Int(), nil
+}
+
+func intOp(op byte, a, b int64) (int64, error) {
+	switch op {
+	case '+':
+		c := a + b
+		if (c > a) != (b > 0) {
+			return 0, errOverflow
+		}
+		return c, nil
+	case '-':
+		c := a - b
+		if (c < a) != (b > 0) {
+			return 0, errOverflow
+		}
+		return c, nil
+	case '*':
+		if a == 0 || b == 0 {
+			return 0, nil
+		}
+		c := a * b
+		if c/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+			return 0, errOverflow
+		}
+		return c, nil
+	case '/':
+		if b == 0 {
+			return 0, errDivideByZero
+		}
+		if a == math.MinInt64 && b == -1 {
+			return 0, errOverflow
+		}
+		return a / b, nil
+	case '%':
+		if b == 0 {
+			return 0, errDivideByZero
+		}
+		if b == -1 {
+			return 0, nil
+		}
+		return a % b, nil
+	}
+	return 0, errors.Errorf("unknown arithmetic operator %c", op)
+}
+
+func uintOp(op byte, a, b uint64) (uint64, error) {
+	switch op {
+	case '+':
+		if a+b < a {
+			return 0, errOverflow
+		}
+		return a + b, nil
+	case '-':
+		if a < b {
+			return 0, errOverflow
+		}
+		return a - b, nil
+	case '*':
+		if a != 0 && (a*b)/a != b {
+			return 0, errOverflow
+		}
+		return a * b, nil
+	case '/':
+		if b == 0 {
+			return 0, errDivideByZero
+		}
+		return a / b, nil
+	case '%':
+		if b == 0 {
+			return 0, errDivideByZero
+		}
+		return a % b, nil
+	}
+	return 0, errors.Errorf("unknown arithmetic operator %c", op)
+}
+
+func floatOp(op byte, a, b float64) (float64, error) {
+	switch op {
+	case '+':
+		return a + b, nil
+	case '-':
+		return a - b, nil
+	case '*':
+		return a * b, nil
+	case '/':
+		if b == 0 {
+			return 0, errDivideByZero
+		}
+		return a / b, nil
+	case '%':
+		if b == 0 {
+			return 0, errDivideByZero
+		}
+		return math.Mod(a, b), nil
+	}
+	return 0, errors.Errorf("unknown arithmetic operator %c", op)
+}
+
+// indexArg checks if a reflect.Value can be used as an index, and converts it to int if possible.
+func indexArg(index interface{}, cap int) (int, error) {
+	v := reflect.ValueOf(index)
+	var x int64
+	switch k, _ := basicKind(v); k {
+	case intKind:
+		x = v.Int()
+	case uintKind:
+		if v.Uint() > math.MaxInt64 {
+			return 0, errors.Errorf("index %d out of range", v.Uint())
+		}
+		x = int64(v.Uint())
+	default:
+		return 0, errors.Errorf("cannot index slice/array with type %T", index)
+	}
+	if x < 0 || x > int64(cap) {
+		return 0, errors.Errorf("index out of range: %d", x)
+	}
+	return int(x), nil
+}
+
+// index returns the result of indexing its first argument by the following arguments.
+// Thus "index x 1 2 3" is, in Go syntax, x[1][2][3]. The missing key of map returns the zero value.
+func index(item interface{}, indexes ...interface{}) (interface{}, error) {
+	v := reflect.ValueOf(item)
+	for _, idx := range indexes {
+		var isNil bool
+		if v, isNil = indirect(v); isNil || !v.IsValid() {
+			return nil, errors.New("index of nil")
+		}
+		switch v.Kind() {
+		case reflect.Array, reflect.Slice, reflect.String:
+			x, err := indexArg(idx, v.Len())
+			if err != nil {
+				return nil, err
+			}
+			if x == v.Len() {
+				return nil, errors.Errorf("index out of range: %d", x)
+			}
+			v = v.Index(x)
+		case reflect.Map:
+			key := reflect.ValueOf(idx)
+			if !key.IsValid() {
+				return nil, errors.New("index of map with nil")
+			}
+			keyType := v.Type().Key()
+			if !key.Type().AssignableTo(keyType) {
+				if !key.Type().ConvertibleTo(keyType) {
+					return nil, errors.Errorf("%s is not a key type of %s", key.Type(), v.Type())
+				}
+				key = key.Convert(keyType)
+			}
+			if x := v.MapIndex(key); x.IsValid() {
+				v = x
+			} else {
+				v = reflect.Zero(v.Type().Elem())
+			}
+		default:
+			return nil, errors.Errorf("can't index item of type %s", v.Type())
+		}
+	}
+	return printableValue(v), nil
+}
+
+// slice returns the result of slicing its first argument by the remaining arguments.
+// Thus "slice x 1 2" is, in Go syntax, x[1:2], while "slice x" is x[:], "slice x 1" is x[1:], and "slice x 1 2 3" is x[1:2:3].
+func slice(item interface{}, indexes ...interface{}) (interface{}, error) {
+	v, isNil := indirect(reflect.ValueOf(item))
+	if isNil || !v.IsValid() {
+		return nil, errors.New("slice of nil")
+	}
+	if len(indexes) > 3 {
+		return nil, errors.Errorf("too many slice indexes: %d", len(indexes))
+	}
+	var cap int
+	switch v.Kind() {
+	case reflect.String:
+		if len(indexes) == 3 {
+			return nil, errors.New("cannot 3-index slice a string")
+		}
+		cap = v.Len()
+	case reflect.Array, reflect.Slice:
+		cap = v.Cap()
+	default:
+		return nil, errors.Errorf("can't slice item of type %s", v.Type())
+	}
+	idx := [3]int{0, v.Len()}
+	for i, index := range indexes {
+		x, err := indexArg(index, cap)
+		if err != nil {
+			return nil, err
+		}
+		idx[i] = x
+	}
+	// given item[i:j], make sure i <= j.
+	if idx[0] > idx[1] {
+		return nil, errors.Errorf("invalid slice index: %d > %d", idx[0], idx[1])
+	}
+	if len(indexes) < 3 {
+		return v.Slice(idx[0], idx[1]).Interface(), nil
+	}
+	// given item[i:j:k], make sure i <= j <= k.
+	if idx[1] > idx[2] {
+		return nil, errors.Errorf("invalid slice index: %d > %d", idx[1], idx[2])
+	}
+	return v.Slice3(idx[0], idx[1], idx[2]).Interface(), nil
+}
+
+// length returns the length of the item, with an error if it has no defined length.
+func length(item interface{}) (int, error) {
+	v, isNil := indirect(reflect.ValueOf(item))
+	if isNil || !v.IsValid() {
+		return 0, errors.New("len of nil")
+	}
+	switch v.Kind() {
+	case reflect.Array, reflect.Chan, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len(), nil
+	}
+	return 0, errors.Errorf("len of type %s", v.Type())
+}
+
+// contains checks if the collection contains the item: the substring of string, the element of slice or array, and the key of map.
+// It is written as `contains item collection`, so that `.tags | contains "web"` works.
+func contains(item, collection interface{}) (bool, error) {
+	v, isNil := indirect(reflect.ValueOf(collection))
+	if isNil || !v.IsValid() {
+		return false, nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		s, ok := item.(string)
+		if !ok {
+			return false, errors.Errorf("can't check %T in string", item)
+		}
+		return strings.Contains(v.String(), s), nil
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if equal(v.Index(i).Interface(), item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			if equal(key.Interface(), item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, errors.Errorf("can't check item in type %s", v.Type())
+}
+
+// equal compares the basic values by eq, so 1 equals to int64(1), the others are compared by reflect.DeepEqual
+func equal(a, b interface{}) bool {
+	if truth, err := eq(a, b); err == nil {
+		return truth
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// replace replaces all the old in s with new, it is written as `replace old new s`, so that `.s | replace "a" "b"` works.
+func replace(old, new, s string) string {
+	return strings.Replace(s, old, new, -1)
+}
+
+// coalesce returns the first non-empty value, nil if all are empty.
+func coalesce(values ...interface{}) interface{} {
+	for _, v := range values {
+		if isTrue(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+// ternary returns vt if condition is true, otherwise returns vf. `.ok | ternary "yes" "no"`.
+func ternary(vt, vf interface{}, condition interface{}) interface{} {
+	if isTrue(condition) {
+		return vt
+	}
+	return vf
+}
@@ -0,0 +1,74 @@
+package template
+
+import "github.com/cloudfly/golang/internal/lru"
+
+// DefaultCacheSize is the capacity of the cache used by Parse
+const DefaultCacheSize = 1024
+
+// cache is used by Parse, so the same template string is parsed only once
+var cache = NewCache(DefaultCacheSize)
+
+// CacheStats is the statistics of Cache
+type CacheStats = lru.Stats
+
+// Cache keeps the templates parsed from strings, the least recently used ones are evicted when it is full.
+// It is safe for concurrent use.
+type Cache struct {
+	lru *lru.Cache
+}
+
+// NewCache create a cache holding at most capacity templates, nothing is cached if capacity <= 0.
+func NewCache(capacity int) *Cache {
+	return &Cache{lru: lru.New(capacity)}
+}
+
+// Get returns the template parsed from s, it is parsed by New() if not in cache. The error is not cached.
+func (c *Cache) Get(s string) (*Template, error) {
+	return c.get(s, New)
+}
+
+func (c *Cache) get(s string, parse func(string) (*Template, error)) (*Template, error) {
+	t, err := c.lru.Get(s, func(s string) (interface{}, error) {
+		return parse(s)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t.(*Template), nil
+}
+
+// Resize changes the capacity, the templates out of capacity are evicted.
+func (c *Cache) Resize(capacity int) {
+	c.lru.Resize(capacity)
+}
+
+// Clear removes all the templates, the statistics are kept.
+// The templates being parsed by Get when Clear is called are returned but not cached.
+func (c *Cache) Clear() {
+	c.lru.Clear()
+}
+
+// Stats returns the statistics of cache
+func (c *Cache) Stats() CacheStats {
+	return c.lru.Stats()
+}
+
+// SetCacheSize changes the capacity of the cache used by Parse, size <= 0 disables the cache.
+func SetCacheSize(size int) {
+	cache.Resize(size)
+}
+
+// ParseCacheStats returns the statistics of the cache used by Parse
+func ParseCacheStats() CacheStats {
+	return cache.Stats()
+}
+
+// MustNew is same with New, but panics if the template can not be parsed.
+// It is used to initialize the global variables, such as `var tmpl = template.MustNew("{{ .a }}")`.
+func MustNew(s string) *Template {
+	t, err := New(s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
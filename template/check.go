@@ -0,0 +1,452 @@
+package template
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template/parse"
+)
+
+// Schema describes the values in Data, it is used to validate the template before executing.
+// The key is the name of value, "a.b" can be used for nested value. The value is a sample whose type is the type of the value,
+// the fields of struct and the elements of map in sample are known by reflection, nil means the value can be any type.
+//
+//	Schema{
+//		"name":   "",
+//		"age":    0,
+//		"tags":   map[string]string{},
+//		"server": Server{},
+//		"extra":  nil,
+//	}
+type Schema map[string]interface{}
+
+// lookup returns the type of the value located by idents, nil type means any type
+func (s Schema) lookup(idents []string) (reflect.Type, bool) {
+	for i := len(idents); i > 0; i-- {
+		sample, ok := s[strings.Join(idents[:i], ".")]
+		if !ok {
+			continue
+		}
+		if sample == nil {
+			return nil, true
+		}
+		typ := reflect.TypeOf(sample)
+		for _, ident := range idents[i:] {
+			if typ, ok = fieldType(typ, ident); !ok {
+				return nil, false
+			}
+			if typ == nil {
+				return nil, true
+			}
+		}
+		return typ, true
+	}
+	return nil, false
+}
+
+// fieldType returns the type of .name in value of typ, nil type means any type
+func fieldType(typ reflect.Type, name string) (reflect.Type, bool) {
+	if method, ok := reflect.PtrTo(typ).MethodByName(name); ok && method.Type.NumOut() > 0 {
+		return knownType(method.Type.Out(0)), true
+	}
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.Interface:
+		return nil, true
+	case reflect.Struct:
+		if field, ok := typ.FieldByName(name); ok && field.PkgPath == "" {
+			return knownType(field.Type), true
+		}
+		if index, ok := jsonFields(typ)[name]; ok {
+			return knownType(typ.FieldByIndex(index).Type), true
+		}
+	case reflect.Map:
+		if typ.Key().Kind() == reflect.String || typ.Key().Kind() == reflect.Interface {
+			return knownType(typ.Elem()), true
+		}
+	}
+	return nil, false
+}
+
+// knownType returns nil for interface types, the type of value is known only at execution.
+func knownType(typ reflect.Type) reflect.Type {
+	if typ.Kind() == reflect.Interface {
+		return nil
+	}
+	return typ
+}
+
+// ValidationError is a mistake found in template by Validate
+type ValidationError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// ValidationErrors is all the mistakes found in template
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+	items := make([]string, len(errs))
+	for i, err := range errs {
+		items[i] = err.Error()
+	}
+	return strings.Join(items, "; ")
+}
+
+// Fields returns the paths of fields referenced by template, such as ".a.b", sorted.
+// The fields of elements in range are not included.
+func (t *Template) Fields() []string {
+	return sortedKeys(t.check(nil).fields)
+}
+
+// Funcs returns the names of functions called by template, sorted.
+func (t *Template) Funcs() []string {
+	return sortedKeys(t.check(nil).funcs)
+}
+
+// Validate checks the template with schema without executing it, the unknown fields and the arguments
+// having wrong type are reported as ValidationErrors. The fields are not checked if schema is nil.
+func (t *Template) Validate(schema Schema) error {
+	c := t.check(schema)
+	if len(c.errs) > 0 {
+		return c.errs
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// typed is the static information of a value in template
+type typed struct {
+	root bool         // the value is the data
+	path string       // the field path from data, such as .a.b, empty if the value is not a field of data
+	typ  reflect.Type // the type of value, nil if unknown
+	node parse.Node   // the literal node, such as "abc" and 1
+}
+
+// checker walks the template without executing it
+type checker struct {
+	tmpl   *Template
+	schema Schema
+	dot    typed
+	vars   []checkVar
+	fields map[string]bool
+	funcs  map[string]bool
+	errs   ValidationErrors
+}
+
+type checkVar struct {
+	name  string
+	value typed
+}
+
+func (t *Template) check(schema Schema) *checker {
+	c := &checker{
+		tmpl:   t,
+		schema: schema,
+		dot:    typed{root: true},
+		vars:   []checkVar{{name: "$", value: typed{root: true}}},
+		fields: make(map[string]bool),
+		funcs:  make(map[string]bool),
+	}
+	for _, node := range t.nodes {
+		c.walk(node)
+	}
+	return c
+}
+
+func (c *checker) errorf(node parse.Node, format string, args ...interface{}) {
+	pos := int(node.Position())
+	// the position of .a.b and $x.a may be at one of the fields, move it to the beginning
+	switch node.(type) {
+	case *parse.FieldNode, *parse.VariableNode:
+		text := node.String()
+		end := pos + len(text)
+		if end > len(c.tmpl.raw) {
+			end = len(c.tmpl.raw)
+		}
+		if start := strings.LastIndex(c.tmpl.raw[:end], text); start >= 0 {
+			pos = start
+		}
+	}
+	if pos > len(c.tmpl.raw) {
+		pos = len(c.tmpl.raw)
+	}
+	before := c.tmpl.raw[:pos]
+	c.errs = append(c.errs, &ValidationError{
+		Line:    strings.Count(before, "\n") + 1,
+		Column:  pos - strings.LastIndex(before, "\n"),
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *checker) walk(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ActionNode:
+		c.checkPipeline(n.Pipe)
+	case *parse.ListNode:
+		for _, node := range n.Nodes {
+			c.walk(node)
+		}
+	case *parse.IfNode:
+		c.walkIfOrWith(parse.NodeIf, n.Pipe, n.List, n.ElseList)
+	case *parse.WithNode:
+		c.walkIfOrWith(parse.NodeWith, n.Pipe, n.List, n.ElseList)
+	case *parse.RangeNode:
+		c.walkRange(n)
+	case *parse.TemplateNode:
+		c.errorf(n, "template %q is not supported", n.Name)
+	}
+}
+
+func (c *checker) walkIfOrWith(typ parse.NodeType, pipe *parse.PipeNode, list, elseList *parse.ListNode) {
+	mark, dot := len(c.vars), c.dot
+	val := c.checkPipeline(pipe)
+	if typ == parse.NodeWith {
+		c.dot = val
+	}
+	c.walk(list)
+	c.dot = dot
+	if elseList != nil {
+		c.walk(elseList)
+	}
+	c.vars = c.vars[:mark]
+}
+
+func (c *checker) walkRange(r *parse.RangeNode) {
+	mark, dot := len(c.vars), c.dot
+	val := c.checkPipeline(r.Pipe)
+	var key, elem typed
+	if typ := val.typ; typ != nil {
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		switch typ.Kind() {
+		case reflect.Array, reflect.Slice:
+			key.typ, elem.typ = reflect.TypeOf(0), knownType(typ.Elem())
+		case reflect.Map:
+			key.typ, elem.typ = knownType(typ.Key()), knownType(typ.Elem())
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			key.typ, elem.typ = typ, typ
+		default:
+			c.errorf(r, "range can't iterate over %s", typ)
+		}
+	}
+	c.vars = c.vars[:mark]
+	switch len(r.Pipe.Decl) {
+	case 1:
+		c.vars = append(c.vars, checkVar{r.Pipe.Decl[0].Ident[0], elem})
+	case 2:
+		c.vars = append(c.vars, checkVar{r.Pipe.Decl[0].Ident[0], key}, checkVar{r.Pipe.Decl[1].Ident[0], elem})
+	}
+	c.dot = elem
+	c.walk(r.List)
+	c.dot = dot
+	if r.ElseList != nil {
+		c.walk(r.ElseList)
+	}
+	c.vars = c.vars[:mark]
+}
+
+func (c *checker) checkPipeline(pipe *parse.PipeNode) typed {
+	var val typed
+	if pipe == nil {
+		return val
+	}
+	for i, cmd := range pipe.Cmds {
+		if i == 0 {
+			val = c.checkCommand(cmd, nil)
+		} else {
+			final := val
+			val = c.checkCommand(cmd, &final)
+		}
+	}
+	for _, variable := range pipe.Decl {
+		if !pipe.IsAssign {
+			c.vars = append(c.vars, checkVar{variable.Ident[0], val})
+		}
+	}
+	return val
+}
+
+func (c *checker) checkCommand(cmd *parse.CommandNode, final *typed) typed {
+	switch n := cmd.Args[0].(type) {
+	case *parse.FieldNode:
+		return c.checkFields(n, c.dot, n.Ident, cmd.Args[1:], final)
+	case *parse.ChainNode:
+		return c.checkFields(n, c.checkArg(n.Node), n.Field, cmd.Args[1:], final)
+	case *parse.VariableNode:
+		return c.checkFields(n, c.variable(n), n.Ident[1:], cmd.Args[1:], final)
+	case *parse.IdentifierNode:
+		return c.checkFunction(n, cmd.Args[1:], final)
+	}
+	return c.checkArg(cmd.Args[0])
+}
+
+func (c *checker) checkArg(node parse.Node) typed {
+	switch n := node.(type) {
+	case *parse.FieldNode:
+		return c.checkFields(n, c.dot, n.Ident, nil, nil)
+	case *parse.ChainNode:
+		return c.checkFields(n, c.checkArg(n.Node), n.Field, nil, nil)
+	case *parse.VariableNode:
+		return c.checkFields(n, c.variable(n), n.Ident[1:], nil, nil)
+	case *parse.IdentifierNode:
+		return c.checkFunction(n, nil, nil)
+	case *parse.PipeNode:
+		return c.checkPipeline(n)
+	case *parse.DotNode:
+		return c.dot
+	case *parse.StringNode, *parse.NumberNode, *parse.BoolNode, *parse.NilNode:
+		return typed{node: n}
+	}
+	return typed{}
+}
+
+func (c *checker) variable(n *parse.VariableNode) typed {
+	for i := len(c.vars) - 1; i >= 0; i-- {
+		if c.vars[i].name == n.Ident[0] {
+			return c.vars[i].value
+		}
+	}
+	c.errorf(n, "undefined variable: %s", n.Ident[0])
+	return typed{}
+}
+
+// checkFields resolves the fields from the receiver, the last one may be a method called with args.
+func (c *checker) checkFields(node parse.Node, receiver typed, idents []string, args []parse.Node, final *typed) typed {
+	val := receiver
+	if len(idents) > 0 && (receiver.root || receiver.path != "") {
+		val = typed{path: receiver.path + "." + strings.Join(idents, ".")}
+		c.fields[val.path] = true
+		if c.schema != nil {
+			typ, ok := c.schema.lookup(strings.Split(val.path[1:], "."))
+			if !ok {
+				c.errorf(node, "unknown field %s", val.path)
+			}
+			val.typ = typ
+		}
+	} else if len(idents) > 0 && receiver.typ != nil {
+		typ := receiver.typ
+		for _, ident := range idents {
+			var ok bool
+			if typ, ok = fieldType(typ, ident); !ok {
+				c.errorf(node, "%s is not a field of %s", ident, receiver.typ)
+				return typed{}
+			}
+			if typ == nil {
+				break
+			}
+		}
+		val = typed{typ: typ}
+	}
+	for _, arg := range args {
+		c.checkArg(arg)
+	}
+	if val.typ != nil && val.typ.Kind() == reflect.Func && val.typ.NumOut() > 0 {
+		return typed{typ: knownType(val.typ.Out(0))}
+	}
+	return val
+}
+
+func (c *checker) checkFunction(n *parse.IdentifierNode, args []parse.Node, final *typed) typed {
+	c.funcs[n.Ident] = true
+	function, ok := c.tmpl.funcs[n.Ident]
+	if !ok {
+		c.errorf(n, "%q is not a defined function", n.Ident)
+		return typed{}
+	}
+	typ := reflect.TypeOf(function)
+	values := make([]typed, len(args))
+	for i, arg := range args {
+		values[i] = c.checkArg(arg)
+	}
+	if final != nil {
+		values = append(values, *final)
+	}
+	numIn := len(values)
+	if typ.IsVariadic() {
+		if numIn < typ.NumIn()-1 {
+			c.errorf(n, "wrong number of args for %s: want at least %d got %d", n.Ident, typ.NumIn()-1, numIn)
+			return typed{}
+		}
+	} else if numIn != typ.NumIn() {
+		c.errorf(n, "wrong number of args for %s: want %d got %d", n.Ident, typ.NumIn(), numIn)
+		return typed{}
+	}
+	for i, val := range values {
+		var param reflect.Type
+		if typ.IsVariadic() && i >= typ.NumIn()-1 {
+			param = typ.In(typ.NumIn() - 1).Elem()
+		} else {
+			param = typ.In(i)
+		}
+		if !assignable(val, param) {
+			node := parse.Node(n)
+			if i < len(args) {
+				node = args[i]
+			}
+			c.errorf(node, "wrong type for argument %d of %s: expected %s, got %s", i+1, n.Ident, param, val.describe())
+		}
+	}
+	return typed{typ: knownType(typ.Out(0))}
+}
+
+// assignable reports whether the value can be passed as a parameter of param type, unknown type is always assignable.
+func assignable(val typed, param reflect.Type) bool {
+	if param.Kind() == reflect.Interface && param.NumMethod() == 0 {
+		return true
+	}
+	switch n := val.node.(type) {
+	case *parse.StringNode:
+		return param.Kind() == reflect.String
+	case *parse.BoolNode:
+		return param.Kind() == reflect.Bool
+	case *parse.NilNode:
+		return canBeNil(param)
+	case *parse.NumberNode:
+		switch param.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return n.IsInt
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return n.IsUint
+		case reflect.Float32, reflect.Float64:
+			return n.IsFloat
+		case reflect.Complex64, reflect.Complex128:
+			return n.IsComplex
+		}
+		return false
+	}
+	typ := val.typ
+	if typ == nil || val.root {
+		return true
+	}
+	return typ.AssignableTo(param) ||
+		typ.Kind() == reflect.Ptr && typ.Elem().AssignableTo(param) ||
+		reflect.PtrTo(typ).AssignableTo(param)
+}
+
+func (val typed) describe() string {
+	if val.node != nil {
+		return val.node.String()
+	}
+	if val.path != "" {
+		return fmt.Sprintf("%s of type %s", val.path, val.typ)
+	}
+	return val.typ.String()
+}
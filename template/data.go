@@ -0,0 +1,139 @@
+package template
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// MapData is a Data backed by a map, nested maps and structs in it can be accessed by .a.b.c
+type MapData map[string]interface{}
+
+// Value implements Data
+func (m MapData) Value(key string) interface{} {
+	return m[key]
+}
+
+type structData struct {
+	rv reflect.Value
+}
+
+// StructData wraps a struct or a pointer to struct as a Data, the exported fields can be accessed
+// by the field name or the name in json tag.
+func StructData(v interface{}) Data {
+	rv, _ := indirect(reflect.ValueOf(v))
+	return structData{rv: rv}
+}
+
+// Value implements Data
+func (s structData) Value(key string) interface{} {
+	if s.rv.Kind() != reflect.Struct {
+		return nil
+	}
+	field, ok := structField(s.rv, key)
+	if !ok {
+		return nil
+	}
+	return field.Interface()
+}
+
+// structFields caches the json tag names of struct types, reflect.Type => map[string][]int
+var structFields sync.Map
+
+// structField returns the exported field of struct by the field name or the name in json tag
+func structField(rv reflect.Value, name string) (reflect.Value, bool) {
+	if tField, ok := rv.Type().FieldByName(name); ok && tField.PkgPath == "" {
+		return fieldByIndex(rv, tField.Index)
+	}
+	index, ok := jsonFields(rv.Type())[name]
+	if !ok {
+		return zero, false
+	}
+	return fieldByIndex(rv, index)
+}
+
+// jsonFields returns the exported fields having a name in json tag
+func jsonFields(typ reflect.Type) map[string][]int {
+	if fields, ok := structFields.Load(typ); ok {
+		return fields.(map[string][]int)
+	}
+	fields := make(map[string][]int)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = field.Index
+		}
+	}
+	structFields.Store(typ, fields)
+	return fields
+}
+
+// fieldByIndex is same with reflect.Value.FieldByIndex, but returns false instead of panic on nil embedded pointer
+func fieldByIndex(rv reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 {
+			var isNil bool
+			if rv, isNil = indirect(rv); isNil {
+				return zero, false
+			}
+		}
+		rv = rv.Field(x)
+	}
+	return rv, true
+}
+
+// KeySpace is a key-value store whose keys are separated by /, dconf.DConf implements it.
+type KeySpace interface {
+	Get(key string) (string, error)
+	Keys(prefix string) []string
+}
+
+type keySpaceData struct {
+	conf   KeySpace
+	prefix string
+}
+
+// DConfData wraps the keys under prefix of a dconf.DConf (or other KeySpace) as a Data.
+// .a.b reads the key {prefix}/a/b, .a returns the keys under {prefix}/a as a Data if there is no key {prefix}/a.
+func DConfData(conf KeySpace, prefix string) Data {
+	return keySpaceData{
+		conf:   conf,
+		prefix: strings.TrimSuffix(prefix, "/"),
+	}
+}
+
+// Value implements Data
+func (k keySpaceData) Value(key string) interface{} {
+	full := k.prefix + "/" + key
+	if v, err := k.conf.Get(full); err == nil {
+		return v
+	}
+	if len(k.conf.Keys(full+"/")) > 0 {
+		return keySpaceData{conf: k.conf, prefix: full}
+	}
+	return nil
+}
+
+type chain []Data
+
+// Chain returns a Data looking up the value in each data in order, the first non-nil value is returned.
+func Chain(data ...Data) Data {
+	return chain(data)
+}
+
+// Value implements Data
+func (c chain) Value(key string) interface{} {
+	for _, data := range c {
+		if data == nil {
+			continue
+		}
+		if v := data.Value(key); v != nil {
+			return v
+		}
+	}
+	return nil
+}
@@ -1,8 +1,14 @@
 package template
 
 import (
+	"fmt"
 	"github.com/pkg/errors"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
 )
 
 var (
@@ -56,6 +62,103 @@ var builtins = map[string]interface{}{
 	"lt": lt, // <
 	"ne": ne, // !=
 
+	// Arithmetic
+	"add": add, // +
+	"sub": sub, // -
+	"mul": mul, // *
+	"div": div, // /
+	"mod": mod, // %
+
+	// Strings
+	"printf":   fmt.Sprintf,
+	"lower":    strings.ToLower,
+	"upper":    strings.ToUpper,
+	"join":     join,
+	"split":    split,
+	"replace":  replace,
+	"trim":     strings.TrimSpace,
+	"contains": contains,
+
+	// Collections
+	"index": index,
+	"slice": slice,
+	"len":   length,
+
+	// Values
+	"default":  defaultValue,
+	"coalesce": coalesce,
+	"ternary":  ternary,
+	"toInt":    toInt,
+	"toFloat":  toFloat,
+	"now":      time.Now,
+	"duration": duration,
+}
+
+var (
+	registryLock sync.RWMutex
+	registry     = map[string]interface{}{}
+)
+
+// Funcs register the functions, so they can be called in all the templates created after, the cache used by Parse is cleared.
+// Each function must have 1 result, or 2 results where the second is an error.
+func Funcs(funcs map[string]interface{}) error {
+	if err := checkFuncs(funcs); err != nil {
+		return err
+	}
+	registryLock.Lock()
+	for name, fn := range funcs {
+		registry[name] = fn
+	}
+	registryLock.Unlock()
+	cache.Clear() // the cached templates are using the old functions
+	return nil
+}
+
+// checkFuncs checks the names and signatures of the functions.
+func checkFuncs(funcs map[string]interface{}) error {
+	for name, fn := range funcs {
+		if !goodName(name) {
+			return errors.Errorf("function name %q is not a valid identifier", name)
+		}
+		v := reflect.ValueOf(fn)
+		if v.Kind() != reflect.Func {
+			return errors.Errorf("value for %q is not a function", name)
+		}
+		if !goodFunc(v.Type()) {
+			return errors.Errorf("can't install function %q with %d results", name, v.Type().NumOut())
+		}
+	}
+	return nil
+}
+
+// mergeFuncs returns the functions can be called in a template: builtins, then the registered, then funcs.
+func mergeFuncs(funcs map[string]interface{}) map[string]interface{} {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	merged := make(map[string]interface{}, len(builtins)+len(registry)+len(funcs))
+	for _, m := range []map[string]interface{}{builtins, registry, funcs} {
+		for name, fn := range m {
+			merged[name] = fn
+		}
+	}
+	return merged
+}
+
+// goodName reports whether the function name is a valid identifier.
+func goodName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_':
+		case i == 0 && !unicode.IsLetter(r):
+			return false
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			return false
+		}
+	}
+	return true
 }
 
 func and(values ...interface{}) bool {
@@ -238,3 +341,109 @@ func goodFunc(typ reflect.Type) bool {
 	}
 	return false
 }
+
+// join concatenates the elements of a slice or array with sep, the elements are formatted by %v.
+func join(sep string, list interface{}) (string, error) {
+	v, isNil := indirect(reflect.ValueOf(list))
+	if isNil || !v.IsValid() {
+		return "", nil
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+	default:
+		return "", errors.Errorf("can't join value of type %s", v.Type())
+	}
+	items := make([]string, v.Len())
+	for i := range items {
+		items[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(items, sep), nil
+}
+
+// split slices s into all substrings separated by sep, it is written as `split sep s` so that `.s | split ","` works.
+func split(sep, s string) []string {
+	return strings.Split(s, sep)
+}
+
+// defaultValue returns value if it is not empty, otherwise returns def. `.a | default 1` returns 1 if .a is missing.
+func defaultValue(def interface{}, value ...interface{}) interface{} {
+	if len(value) == 0 || !isTrue(value[0]) {
+		return def
+	}
+	return value[0]
+}
+
+// toInt converts numbers, booleans and strings to int64.
+func toInt(value interface{}) (int64, error) {
+	v, isNil := indirect(reflect.ValueOf(value))
+	if isNil || !v.IsValid() {
+		return 0, errors.New("can't convert nil to int")
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return 1, nil
+		}
+		return 0, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > 1<<63-1 {
+			return 0, errors.Errorf("%d overflows int64", v.Uint())
+		}
+		return int64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return int64(v.Float()), nil
+	case reflect.String:
+		s := strings.TrimSpace(v.String())
+		if n, err := strconv.ParseInt(s, 0, 64); err == nil {
+			return n, nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, errors.Errorf("can't convert %q to int", v.String())
+		}
+		return int64(f), nil
+	}
+	return 0, errors.Errorf("can't convert value of type %s to int", v.Type())
+}
+
+// toFloat converts numbers, booleans and strings to float64.
+func toFloat(value interface{}) (float64, error) {
+	v, isNil := indirect(reflect.ValueOf(value))
+	if isNil || !v.IsValid() {
+		return 0, errors.New("can't convert nil to float")
+	}
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), nil
+	case reflect.String:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v.String()), 64)
+		if err != nil {
+			return 0, errors.Errorf("can't convert %q to float", v.String())
+		}
+		return f, nil
+	}
+	n, err := toInt(value)
+	if err != nil {
+		return 0, errors.Errorf("can't convert value of type %s to float", v.Type())
+	}
+	return float64(n), nil
+}
+
+// duration converts a string like "1m30s" or a number of seconds to time.Duration.
+func duration(value interface{}) (time.Duration, error) {
+	switch v := value.(type) {
+	case time.Duration:
+		return v, nil
+	case string:
+		return time.ParseDuration(v)
+	}
+	seconds, err := toFloat(value)
+	if err != nil {
+		return 0, errors.Errorf("can't convert value of type %T to duration", value)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
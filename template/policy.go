@@ -0,0 +1,141 @@
+package template
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// Policy limits the execution of template, it is used to run the templates written by users.
+type Policy struct {
+	// MaxSteps is the max number of nodes and commands evaluated, 0 means no limit.
+	// Each iteration of range costs steps, so it stops the templates such as {{ range 1000000000 }}.
+	MaxSteps int
+	// MaxOutput is the max bytes of the rendered string, 0 means no limit.
+	MaxOutput int
+	// Funcs is the functions allowed to be called, nil means all the functions are allowed.
+	Funcs []string
+	// Methods is the methods allowed to be called on values in Data, such as "Format" or "time.Time.Format",
+	// the functions in Data are allowed by name. nil means all the methods are allowed.
+	Methods []string
+}
+
+// The limits of Policy
+const (
+	LimitSteps   = "steps"
+	LimitOutput  = "output"
+	LimitTimeout = "timeout"
+	LimitCall    = "call"
+)
+
+// LimitError is returned when the execution is stopped by Policy or context.
+type LimitError struct {
+	Limit   string // one of LimitSteps, LimitOutput, LimitTimeout and LimitCall
+	Message string
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("template: %s limit: %s", e.Limit, e.Message)
+}
+
+// IsLimitError checks if the execution is stopped by Policy or context
+func IsLimitError(err error) bool {
+	_, ok := errors.Cause(err).(*LimitError)
+	return ok
+}
+
+// ExecuteContext is same with Execute, but the execution is limited by policy and stopped when ctx is done.
+// The policy can be nil.
+func (t *Template) ExecuteContext(ctx context.Context, data Data, policy *Policy) (result interface{}, err error) {
+	s := &state{
+		tmpl: t,
+		data: data,
+		vars: []variable{{name: "$"}},
+		ctx:  ctx,
+	}
+	if policy != nil {
+		s.policy = policy
+		s.funcs = allowSet(policy.Funcs)
+		s.methods = allowSet(policy.Methods)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, errors.Errorf("panic in template: %v", r)
+		}
+	}()
+	return s.execute()
+}
+
+func allowSet(names []string) map[string]bool {
+	if names == nil {
+		return nil
+	}
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
+// step is called before evaluating each node and command
+func (s *state) step() error {
+	if s.ctx != nil {
+		select {
+		case <-s.ctx.Done():
+			return &LimitError{Limit: LimitTimeout, Message: s.ctx.Err().Error()}
+		default:
+		}
+	}
+	if s.policy == nil || s.policy.MaxSteps <= 0 {
+		return nil
+	}
+	s.steps++
+	if s.steps > s.policy.MaxSteps {
+		return &LimitError{Limit: LimitSteps, Message: fmt.Sprintf("more than %d steps", s.policy.MaxSteps)}
+	}
+	return nil
+}
+
+// write appends the text to output
+func (s *state) write(text string) error {
+	if s.policy != nil && s.policy.MaxOutput > 0 && s.out.Len()+len(text) > s.policy.MaxOutput {
+		return &LimitError{Limit: LimitOutput, Message: fmt.Sprintf("output is more than %d bytes", s.policy.MaxOutput)}
+	}
+	s.out.WriteString(text)
+	return nil
+}
+
+// checkOutput checks the size of the value returned by a single action
+func (s *state) checkOutput(v interface{}) error {
+	if text, ok := v.(string); ok && s.policy != nil && s.policy.MaxOutput > 0 && len(text) > s.policy.MaxOutput {
+		return &LimitError{Limit: LimitOutput, Message: fmt.Sprintf("output is more than %d bytes", s.policy.MaxOutput)}
+	}
+	return nil
+}
+
+// allowFunc checks if the function can be called
+func (s *state) allowFunc(name string) error {
+	if s.funcs != nil && !s.funcs[name] {
+		return &LimitError{Limit: LimitCall, Message: fmt.Sprintf("function %s is not allowed", name)}
+	}
+	return nil
+}
+
+// allowMethod checks if the method of receiver, or the function in Data if receiver is invalid, can be called
+func (s *state) allowMethod(receiver reflect.Value, name string) error {
+	if s.methods == nil || s.methods[name] {
+		return nil
+	}
+	if receiver.IsValid() {
+		typ := receiver.Type()
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		if s.methods[typ.String()+"."+name] {
+			return nil
+		}
+	}
+	return &LimitError{Limit: LimitCall, Message: fmt.Sprintf("method %s is not allowed", name)}
+}
@@ -0,0 +1,160 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RenderJSON renders a JSON document, each string value in it is executed as a template, and replaced by the result in its own type,
+// so "{{ .port }}" becomes the number 8080 if .port is an int, and "{{ .tags }}" becomes an object if .tags is a map.
+// The object keys are not rendered and kept in their order. The error is prefixed by the path of the value, such as $.servers[0].port.
+func RenderJSON(doc []byte, data Data) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	r := &jsonRenderer{dec: dec, data: data}
+	if err := r.render("$"); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("invalid JSON document: data after the top-level value")
+	}
+	return r.buf.Bytes(), nil
+}
+
+type jsonRenderer struct {
+	dec  *json.Decoder
+	data Data
+	buf  bytes.Buffer
+}
+
+func (r *jsonRenderer) render(path string) error {
+	tok, err := r.dec.Token()
+	if err != nil {
+		return errors.Wrapf(err, "invalid JSON document at %s", path)
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			r.buf.WriteByte('{')
+			for i := 0; r.dec.More(); i++ {
+				tok, err := r.dec.Token()
+				if err != nil {
+					return errors.Wrapf(err, "invalid JSON document at %s", path)
+				}
+				key := tok.(string)
+				if i > 0 {
+					r.buf.WriteByte(',')
+				}
+				if err := r.write(key); err != nil {
+					return err
+				}
+				r.buf.WriteByte(':')
+				if err := r.render(path + "." + key); err != nil {
+					return err
+				}
+			}
+			r.buf.WriteByte('}')
+		case '[':
+			r.buf.WriteByte('[')
+			for i := 0; r.dec.More(); i++ {
+				if i > 0 {
+					r.buf.WriteByte(',')
+				}
+				if err := r.render(fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+			r.buf.WriteByte(']')
+		}
+		// the closing delimiter
+		if _, err := r.dec.Token(); err != nil {
+			return errors.Wrapf(err, "invalid JSON document at %s", path)
+		}
+		return nil
+	case string:
+		v, err := renderString(t, r.data)
+		if err != nil {
+			return errors.Wrap(err, path)
+		}
+		if err := r.write(v); err != nil {
+			return errors.Wrap(err, path)
+		}
+		return nil
+	}
+	return r.write(tok)
+}
+
+func (r *jsonRenderer) write(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	r.buf.Write(b)
+	return nil
+}
+
+// renderString executes s as a template if it contains an action, the templates are cached.
+func renderString(s string, data Data) (interface{}, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+	t, err := cache.Get(s)
+	if err != nil {
+		return nil, err
+	}
+	return t.Execute(data)
+}
+
+// Render renders a decoded document, such as the value decoded from YAML or JSON. The string values are executed as template,
+// the maps (map[string]interface{}, map[interface{}]interface{}) and slices ([]interface{}) are walked, and a new document is returned.
+func Render(doc interface{}, data Data) (interface{}, error) {
+	return render(doc, data, "$")
+}
+
+func render(doc interface{}, data Data, path string) (interface{}, error) {
+	switch v := doc.(type) {
+	case string:
+		result, err := renderString(v, data)
+		if err != nil {
+			return nil, errors.Wrap(err, path)
+		}
+		return result, nil
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			item, err := render(item, data, path+"."+key)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = item
+		}
+		return result, nil
+	case map[interface{}]interface{}:
+		result := make(map[interface{}]interface{}, len(v))
+		for key, item := range v {
+			item, err := render(item, data, fmt.Sprintf("%s.%v", path, key))
+			if err != nil {
+				return nil, err
+			}
+			result[key] = item
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			item, err := render(item, data, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			result[i] = item
+		}
+		return result, nil
+	}
+	return doc, nil
+}
@@ -1,16 +1,19 @@
 package template
 
 import (
+	"context"
 	"fmt"
 	"github.com/pkg/errors"
 	"reflect"
+	"sort"
 	"strings"
 	"text/template/parse"
 )
 
 var (
-	zero      reflect.Value
-	errorType = reflect.TypeOf((*error)(nil)).Elem()
+	zero               reflect.Value
+	errorType          = reflect.TypeOf((*error)(nil)).Elem()
+	emptyInterfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
 )
 
 // Data represent a data source, which contains the value used in template. template will find value in it.
@@ -22,14 +25,67 @@ type Data interface {
 type Template struct {
 	raw   string
 	nodes []parse.Node
+	funcs map[string]interface{}
+}
+
+// state is the context of one execution
+type state struct {
+	tmpl *Template
+	data Data
+	dot  reflect.Value // the value of ., it is invalid at the top level, means the fields are looked up in data
+	vars []variable    // the variables declared in template, the first one is $
+	out  strings.Builder
+
+	ctx     context.Context
+	policy  *Policy
+	steps   int
+	funcs   map[string]bool // the allowed functions, nil means all
+	methods map[string]bool // the allowed methods, nil means all
+}
+
+// variable holds the dynamic value of a variable such as $, $x etc.
+type variable struct {
+	name  string
+	value reflect.Value
+}
+
+// walkBreak and walkContinue are returned by walk when meeting {{ break }} and {{ continue }} in range
+var (
+	walkBreak    = errors.New("break")
+	walkContinue = errors.New("continue")
+)
+
+// missingError is returned when a value is not found in Data or a map.
+// In a pipeline, the missing value is passed to the next command as nil, so `.a | default 1` works.
+type missingError struct {
+	msg string
+}
+
+func (e missingError) Error() string {
+	return e.msg
+}
+
+func isMissing(err error) bool {
+	_, ok := errors.Cause(err).(missingError)
+	return ok
 }
 
 // New create a new template from a string
 func New(s string) (*Template, error) {
+	return NewWithFuncs(s, nil)
+}
+
+// NewWithFuncs create a new template from a string, the funcs can be called in template besides the builtin functions
+// and the functions registered by Funcs(). Each function must have 1 result, or 2 results where the second is an error.
+func NewWithFuncs(s string, funcs map[string]interface{}) (*Template, error) {
+	if err := checkFuncs(funcs); err != nil {
+		return nil, err
+	}
 	t := &Template{
-		raw: s,
+		raw:   s,
+		funcs: mergeFuncs(funcs),
 	}
-	sets, err := parse.Parse("default", t.raw, "", "", builtins)
+	sets, err := parse.Parse("default", t.raw, "", "", t.funcs)
 	if err != nil {
 		return nil, err
 	}
@@ -42,92 +98,283 @@ func (t *Template) String() string {
 	return t.raw
 }
 
-// Execute return the golang value which the template represented
+// Execute return the golang value which the template represented.
+// If the template is a single action such as "{{ .a }}", the value of the action is returned as it is,
+// otherwise the template is rendered as a string, such as "{{ .a }}{{ .b }}" or "{{ range .list }}{{ . }}{{ end }}".
 func (t *Template) Execute(data Data) (interface{}, error) {
-	switch len(t.nodes) {
+	return t.ExecuteContext(context.Background(), data, nil)
+}
+
+func (s *state) execute() (interface{}, error) {
+	switch len(s.tmpl.nodes) {
 	case 0:
-		return t.raw, nil
+		return s.tmpl.raw, nil
 	case 1:
-		switch n := t.nodes[0].(type) {
+		switch n := s.tmpl.nodes[0].(type) {
 		case *parse.ActionNode:
-			v, err := evalAction(n, data) // execute the value from the template
+			if len(n.Pipe.Decl) > 0 { // {{ $x := .a }} prints nothing
+				break
+			}
+			v, err := s.evalAction(n) // execute the value from the template
 			if err != nil {
 				return nil, err
 			}
-			return v.Interface(), nil
+			result := printableValue(v)
+			if err := s.checkOutput(result); err != nil {
+				return nil, err
+			}
+			return result, nil
 		case *parse.TextNode:
 			return n.String(), nil
-		default:
-			return nil, errors.Errorf("unvalid node type %d", n.Type())
 		}
-
-	default: // having multiple node in text, means it must be a string value, such as "{{ .a }}{{ .b }}" can not return a single golang value, it must be a string.
-		s := ""
-		for _, node := range t.nodes {
-			switch n := node.(type) {
-			case *parse.ActionNode:
-				v, err := evalAction(n, data)
-				if err != nil {
-					return nil, err
-				}
-				s = fmt.Sprintf("%s%v", s, v.Interface())
-			case *parse.TextNode:
-				s = fmt.Sprintf("%s%s", s, n.String())
-			default:
-				return nil, errors.Errorf("unvalid node type %d", n.Type())
-			}
-
+	}
+	// having multiple node in text, means it must be a string value, such as "{{ .a }}{{ .b }}" can not return a single golang value, it must be a string.
+	for _, node := range s.tmpl.nodes {
+		if err := s.walk(node); err != nil {
+			return nil, err
 		}
-		return s, nil
 	}
+	return s.out.String(), nil
 }
 
 // Parse a template string directlly, it is same to call New() and then Execute().
+// The parsed templates are cached, so the same string is parsed only once, see SetCacheSize().
 func Parse(s string, data Data) (interface{}, error) {
-	tmp, err := New(s)
+	tmp, err := cache.Get(s)
 	if err != nil {
 		return nil, err
 	}
 	return tmp.Execute(data)
 }
 
-func evalAction(action *parse.ActionNode, data Data) (value reflect.Value, err error) {
-	return evalPipeline(action.Pipe, data)
+// walk renders the node into s.out
+func (s *state) walk(node parse.Node) error {
+	if err := s.step(); err != nil {
+		return err
+	}
+	switch n := node.(type) {
+	case *parse.ActionNode:
+		v, err := s.evalAction(n)
+		if err != nil {
+			return err
+		}
+		if len(n.Pipe.Decl) == 0 {
+			return s.write(fmt.Sprint(printableValue(v)))
+		}
+	case *parse.TextNode:
+		return s.write(string(n.Text))
+	case *parse.ListNode:
+		for _, node := range n.Nodes {
+			if err := s.walk(node); err != nil {
+				return err
+			}
+		}
+	case *parse.IfNode:
+		return s.walkIfOrWith(parse.NodeIf, n.Pipe, n.List, n.ElseList)
+	case *parse.WithNode:
+		return s.walkIfOrWith(parse.NodeWith, n.Pipe, n.List, n.ElseList)
+	case *parse.RangeNode:
+		return s.walkRange(n)
+	case *parse.BreakNode:
+		return walkBreak
+	case *parse.ContinueNode:
+		return walkContinue
+	case *parse.CommentNode:
+	default:
+		return errors.Errorf("unsupported node %s", node)
+	}
+	return nil
+}
+
+// walkIfOrWith walks an 'if' or 'with' node. The two control structures are almost identical,
+// but 'with' sets dot to the value of pipeline. A missing value is considered as empty.
+func (s *state) walkIfOrWith(typ parse.NodeType, pipe *parse.PipeNode, list, elseList *parse.ListNode) error {
+	defer s.pop(s.mark())
+	val, err := s.evalPipeline(pipe)
+	if err != nil && !isMissing(err) {
+		return err
+	}
+	if err == nil && isTrue(printableValue(val)) {
+		if typ == parse.NodeWith {
+			defer s.setDot(s.dot)
+			s.dot = val
+		}
+		return s.walk(list)
+	} else if elseList != nil {
+		return s.walk(elseList)
+	}
+	return nil
+}
+
+// walkRange walks a 'range' node over array, slice, map or integer, the keys of map are visited in sorted order.
+func (s *state) walkRange(r *parse.RangeNode) error {
+	defer s.pop(s.mark())
+	defer s.setDot(s.dot)
+	val, err := s.evalPipeline(r.Pipe)
+	if err != nil && !isMissing(err) {
+		return err
+	}
+	// mark top of stack before any variables in the body are pushed.
+	mark := s.mark()
+	oneIteration := func(index, elem reflect.Value) (bool, error) {
+		if len(r.Pipe.Decl) > 0 {
+			if r.Pipe.IsAssign {
+				s.setVar(r.Pipe.Decl[len(r.Pipe.Decl)-1].Ident[0], elem)
+			} else {
+				s.setTopVar(1, elem)
+			}
+		}
+		if len(r.Pipe.Decl) > 1 {
+			if r.Pipe.IsAssign {
+				s.setVar(r.Pipe.Decl[0].Ident[0], index)
+			} else {
+				s.setTopVar(2, index)
+			}
+		}
+		s.dot = elem
+		defer s.pop(mark)
+		switch err := s.walk(r.List); err {
+		case nil, walkContinue:
+			return true, nil
+		case walkBreak:
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+	val, _ = indirect(val)
+	n := 0
+	switch val.Kind() {
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < val.Len(); i++ {
+			n++
+			if more, err := oneIteration(reflect.ValueOf(i), val.Index(i)); !more || err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, key := range sortKeys(val.MapKeys()) {
+			n++
+			if more, err := oneIteration(key, val.MapIndex(key)); !more || err != nil {
+				return err
+			}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		for i := int64(0); i < val.Int(); i++ {
+			n++
+			v := reflect.ValueOf(i).Convert(val.Type())
+			if more, err := oneIteration(v, v); !more || err != nil {
+				return err
+			}
+		}
+	case reflect.Invalid:
+		// a missing or nil value is considered as empty
+	default:
+		return errors.Errorf("range can't iterate over %v", printableValue(val))
+	}
+	if n == 0 && r.ElseList != nil {
+		return s.walk(r.ElseList)
+	}
+	return nil
+}
+
+// push pushes a new variable on the stack.
+func (s *state) push(name string, value reflect.Value) {
+	s.vars = append(s.vars, variable{name, value})
+}
+
+// mark returns the length of the variable stack.
+func (s *state) mark() int {
+	return len(s.vars)
+}
+
+// pop pops the variable stack up to the mark.
+func (s *state) pop(mark int) {
+	s.vars = s.vars[0:mark]
+}
+
+func (s *state) setDot(dot reflect.Value) {
+	s.dot = dot
+}
+
+// setVar overwrites the last declared variable with the given name.
+func (s *state) setVar(name string, value reflect.Value) {
+	for i := s.mark() - 1; i >= 0; i-- {
+		if s.vars[i].name == name {
+			s.vars[i].value = value
+			return
+		}
+	}
+}
+
+// setTopVar overwrites the top-nth variable on the stack. Used by range iterations.
+func (s *state) setTopVar(n int, value reflect.Value) {
+	s.vars[len(s.vars)-n].value = value
+}
+
+// varValue returns the value of the named variable.
+func (s *state) varValue(name string) (reflect.Value, error) {
+	for i := s.mark() - 1; i >= 0; i-- {
+		if s.vars[i].name == name {
+			return s.vars[i].value, nil
+		}
+	}
+	return zero, errors.Errorf("undefined variable: %s", name)
+}
+
+func (s *state) evalAction(action *parse.ActionNode) (value reflect.Value, err error) {
+	return s.evalPipeline(action.Pipe)
 }
 
 // evalPipeline returns the value acquired by evaluating a pipeline. If the
 // pipeline has a variable declaration, the variable will be pushed on the
 // stack. Callers should therefore pop the stack after they are finished
 // executing commands depending on the pipeline value.
-func evalPipeline(pipe *parse.PipeNode, data Data) (value reflect.Value, err error) {
+func (s *state) evalPipeline(pipe *parse.PipeNode) (value reflect.Value, err error) {
 	if pipe == nil {
 		return value, errors.New("pipenode is nil")
 	}
-	for _, cmd := range pipe.Cmds {
-		value, err = evalCommand(cmd, data, value) // previous value is this one's final arg.
+	for i, cmd := range pipe.Cmds {
+		value, err = s.evalCommand(cmd, value) // previous value is this one's final arg.
 		if err != nil {
+			if isMissing(err) && i < len(pipe.Cmds)-1 {
+				value = reflect.Zero(emptyInterfaceType) // pass the missing value to next command as nil
+				continue
+			}
 			return value, errors.Wrap(err, "fail to eval command")
 		}
 		if value.Kind() == reflect.Interface && value.Type().NumMethod() == 0 {
 			value = reflect.ValueOf(value.Interface()) // lovely!
 		}
 	}
+	for _, variable := range pipe.Decl {
+		if pipe.IsAssign {
+			s.setVar(variable.Ident[0], value)
+		} else {
+			s.push(variable.Ident[0], value)
+		}
+	}
 	return value, nil
 }
 
-func evalCommand(cmd *parse.CommandNode, data Data, final reflect.Value) (reflect.Value, error) {
+func (s *state) evalCommand(cmd *parse.CommandNode, final reflect.Value) (reflect.Value, error) {
+	if err := s.step(); err != nil {
+		return zero, err
+	}
 	firstWord := cmd.Args[0]
 	switch n := firstWord.(type) {
 	case *parse.FieldNode:
-		return evalFieldNode(firstWord.(*parse.FieldNode), data, cmd.Args, final)
+		return s.evalFieldNode(firstWord.(*parse.FieldNode), cmd.Args, final)
 	case *parse.ChainNode:
-		return evalChainNode(n, data, cmd.Args, final)
+		return s.evalChainNode(n, cmd.Args, final)
 	case *parse.IdentifierNode:
 		// Must be a function.
-		return evalFunction(n, data, cmd, cmd.Args, final)
+		return s.evalFunction(n, cmd, cmd.Args, final)
 	case *parse.PipeNode:
 		// Parenthesized pipeline. The arguments are all inside the pipeline; final is ignored.
-		return evalPipeline(n, data)
+		return s.evalPipeline(n)
+	case *parse.VariableNode:
+		return s.evalVariableNode(n, cmd.Args, final)
 	}
 
 	// firstWord is not a function, so it can not having argument, check here.
@@ -138,6 +385,8 @@ func evalCommand(cmd *parse.CommandNode, data Data, final reflect.Value) (reflec
 	switch word := firstWord.(type) {
 	case *parse.BoolNode:
 		return reflect.ValueOf(word.True), nil
+	case *parse.DotNode:
+		return s.dotValue(), nil
 	case *parse.NumberNode:
 		return idealConstant(word)
 	case *parse.StringNode:
@@ -151,11 +400,44 @@ func evalCommand(cmd *parse.CommandNode, data Data, final reflect.Value) (reflec
 
 }
 
-func evalFieldNode(field *parse.FieldNode, data Data, args []parse.Node, final reflect.Value) (reflect.Value, error) {
-	return evalFieldChain(field, data, field.Ident, args, final, zero)
+func (s *state) evalFieldNode(field *parse.FieldNode, args []parse.Node, final reflect.Value) (reflect.Value, error) {
+	return s.evalFieldChain(field, field.Ident, args, final, s.dot)
 }
 
-func evalChainNode(chain *parse.ChainNode, data Data, args []parse.Node, final reflect.Value) (reflect.Value, error) {
+func (s *state) evalVariableNode(variable *parse.VariableNode, args []parse.Node, final reflect.Value) (reflect.Value, error) {
+	// $x.Field has $x as the first ident, Field as the second. Eval the var, then the fields.
+	value, err := s.varValue(variable.Ident[0])
+	if err != nil {
+		return zero, err
+	}
+	if variable.Ident[0] == "$" && !value.IsValid() {
+		// $ is always the data, even if dot is changed by range or with. $.x is looked up in data by evalFieldChain.
+		if len(variable.Ident) > 1 {
+			return s.evalFieldChain(variable, variable.Ident[1:], args, final, zero)
+		}
+		value = reflect.ValueOf(s.data)
+	}
+	if len(variable.Ident) == 1 {
+		if len(args) > 1 || final.IsValid() {
+			return zero, errors.Errorf("can not give argument to non-function %s", variable)
+		}
+		return value, nil
+	}
+	if !value.IsValid() {
+		return zero, missingError{fmt.Sprintf("variable %s is nil", variable.Ident[0])}
+	}
+	return s.evalFieldChain(variable, variable.Ident[1:], args, final, value)
+}
+
+// dotValue returns the value of dot, the data is returned at the top level.
+func (s *state) dotValue() reflect.Value {
+	if s.dot.IsValid() {
+		return s.dot
+	}
+	return reflect.ValueOf(s.data)
+}
+
+func (s *state) evalChainNode(chain *parse.ChainNode, args []parse.Node, final reflect.Value) (reflect.Value, error) {
 	if len(chain.Field) == 0 {
 		return zero, errors.New("internal error: no fields in evalChainNode")
 	}
@@ -163,31 +445,34 @@ func evalChainNode(chain *parse.ChainNode, data Data, args []parse.Node, final r
 		return zero, errors.Errorf("indirection through explicit nil in %s", chain)
 	}
 	// (pipe).Field1.Field2 has pipe as .Node, fields as .Field. Eval the pipeline, then the fields.
-	pipe, err := evalArg(chain.Node, data, nil)
+	pipe, err := s.evalArg(chain.Node, nil)
 	if err != nil {
 		return zero, err
 	}
-	return evalFieldChain(chain, data, chain.Field, args, final, pipe)
+	return s.evalFieldChain(chain, chain.Field, args, final, pipe)
 }
 
 // evalFieldChain evaluates .X.Y.Z possibly followed by arguments.
 // receiver is the value being walked along the chain.
-func evalFieldChain(node parse.Node, data Data, ident []string, args []parse.Node, final, receiver reflect.Value) (reflect.Value, error) {
+func (s *state) evalFieldChain(node parse.Node, ident []string, args []parse.Node, final, receiver reflect.Value) (reflect.Value, error) {
 	n, from := len(ident), 0
 	if n == 0 {
 		return zero, errors.New("no field defined in fieldNode")
 	}
 	if !receiver.IsValid() {
-		if tmp := data.Value(ident[0]); tmp != nil {
+		if tmp := s.data.Value(ident[0]); tmp != nil {
 			receiver = reflect.ValueOf(tmp)
 		} else {
-			return zero, errors.Errorf("value %s not found or is nil", ident[0])
+			return zero, missingError{fmt.Sprintf("value %s not found or is nil", ident[0])}
 		}
 		// TODO can not return it directlly, it may be a function
 		if n == 1 {
 			// check if it's a function
 			if receiver.IsValid() && receiver.Type().Kind() == reflect.Func {
-				return evalCall(receiver, args, data, ident[0], final)
+				if err := s.allowMethod(zero, ident[0]); err != nil {
+					return zero, err
+				}
+				return s.evalCall(receiver, args, ident[0], final)
 			}
 			return receiver, nil
 		}
@@ -195,19 +480,19 @@ func evalFieldChain(node parse.Node, data Data, ident []string, args []parse.Nod
 	}
 	var err error
 	for i := from; i < n-1; i++ {
-		receiver, err = evalField(node, data, ident[i], nil, zero, receiver)
+		receiver, err = s.evalField(node, ident[i], nil, zero, receiver)
 		if err != nil {
 			return zero, err
 		}
 	}
 	// Now if it's a method, it gets the arguments.
-	return evalField(node, data, ident[n-1], args, final, receiver)
+	return s.evalField(node, ident[n-1], args, final, receiver)
 }
 
 // evalField evaluates an expression like (.Field) or (.Field arg1 arg2).
 // The 'final' argument represents the return value from the preceding
 // value of the pipeline, if any.
-func evalField(node parse.Node, data Data, fieldName string, args []parse.Node, final, receiver reflect.Value) (reflect.Value, error) {
+func (s *state) evalField(node parse.Node, fieldName string, args []parse.Node, final, receiver reflect.Value) (reflect.Value, error) {
 	if !receiver.IsValid() {
 		return zero, errors.New("unvalid receiver value")
 	}
@@ -220,9 +505,24 @@ func evalField(node parse.Node, data Data, fieldName string, args []parse.Node,
 		ptr = ptr.Addr()
 	}
 	if method := ptr.MethodByName(fieldName); method.IsValid() {
-		return evalCall(method, args, data, fieldName, final)
+		if err := s.allowMethod(receiver, fieldName); err != nil {
+			return zero, err
+		}
+		return s.evalCall(method, args, fieldName, final)
 	}
 	hasArgs := len(args) > 1 || final.IsValid()
+	// A nested Data, such as the directory of DConfData.
+	if receiver.CanInterface() {
+		if data, ok := receiver.Interface().(Data); ok {
+			if hasArgs {
+				return zero, errors.Errorf("%s is not a method but has arguments", fieldName)
+			}
+			if v := data.Value(fieldName); v != nil {
+				return reflect.ValueOf(v), nil
+			}
+			return zero, missingError{fmt.Sprintf("value %s not found or is nil", fieldName)}
+		}
+	}
 	// It's not a method; must be a field of a struct or an element of a map. The receiver must not be nil.
 	receiver, isNil := indirect(receiver)
 	if isNil {
@@ -231,11 +531,11 @@ func evalField(node parse.Node, data Data, fieldName string, args []parse.Node,
 	switch receiver.Kind() {
 	case reflect.Struct:
 		tField, ok := receiver.Type().FieldByName(fieldName)
-		if ok {
-			field := receiver.FieldByIndex(tField.Index)
-			if tField.PkgPath != "" { // field is unexported
-				return zero, errors.Errorf("%s is an unexported field of struct type %s", fieldName, typ)
-			}
+		if ok && tField.PkgPath != "" { // field is unexported
+			return zero, errors.Errorf("%s is an unexported field of struct type %s", fieldName, typ)
+		}
+		// the field can also be accessed by the name in json tag
+		if field, ok := structField(receiver, fieldName); ok {
 			// If it's a function, we must call it.
 			if hasArgs {
 				return zero, errors.Errorf("%s has arguments but cannot be invoked as function", fieldName)
@@ -246,13 +546,16 @@ func evalField(node parse.Node, data Data, fieldName string, args []parse.Node,
 	case reflect.Map:
 		// If it's a map, attempt to use the field name as a key.
 		nameVal := reflect.ValueOf(fieldName)
+		if keyType := receiver.Type().Key(); keyType.Kind() == reflect.String && !nameVal.Type().AssignableTo(keyType) {
+			nameVal = nameVal.Convert(keyType) // such as map[Name]string
+		}
 		if nameVal.Type().AssignableTo(receiver.Type().Key()) {
 			if hasArgs {
 				return zero, errors.Errorf("%s is not a method but has arguments", fieldName)
 			}
 			result := receiver.MapIndex(nameVal)
 			if !result.IsValid() {
-				return zero, errors.Errorf("map has no entry for key %q", fieldName)
+				return zero, missingError{fmt.Sprintf("map has no entry for key %q", fieldName)}
 			}
 			return result, nil
 		}
@@ -260,16 +563,19 @@ func evalField(node parse.Node, data Data, fieldName string, args []parse.Node,
 	return zero, errors.Errorf("can't evaluate field %s in type %s", fieldName, typ)
 }
 
-func evalFunction(node *parse.IdentifierNode, data Data, cmd parse.Node, args []parse.Node, final reflect.Value) (reflect.Value, error) {
+func (s *state) evalFunction(node *parse.IdentifierNode, cmd parse.Node, args []parse.Node, final reflect.Value) (reflect.Value, error) {
 	name := node.Ident
-	function, ok := builtins[name]
+	function, ok := s.tmpl.funcs[name]
 	if !ok {
 		return zero, errors.Errorf("%q is not a defined function", name)
 	}
-	return evalCall(reflect.ValueOf(function), args, data, name, final)
+	if err := s.allowFunc(name); err != nil {
+		return zero, err
+	}
+	return s.evalCall(reflect.ValueOf(function), args, name, final)
 }
 
-func evalArg(n parse.Node, data Data, typ reflect.Type) (reflect.Value, error) {
+func (s *state) evalArg(n parse.Node, typ reflect.Type) (reflect.Value, error) {
 	switch arg := n.(type) {
 	case *parse.NilNode:
 		if canBeNil(typ) {
@@ -277,26 +583,43 @@ func evalArg(n parse.Node, data Data, typ reflect.Type) (reflect.Value, error) {
 		}
 		return zero, errors.Errorf("cannot assign nil to %s", typ)
 	case *parse.FieldNode:
-		tmp, err := evalFieldNode(arg, data, []parse.Node{n}, zero)
+		tmp, err := s.evalFieldNode(arg, []parse.Node{n}, zero)
 		if err != nil {
+			if isMissing(err) && typ != nil && canBeNil(typ) {
+				return reflect.Zero(typ), nil
+			}
 			return zero, err
 		}
 		return validateType(tmp, typ)
 	case *parse.PipeNode:
-		tmp, err := evalPipeline(arg, data)
+		tmp, err := s.evalPipeline(arg)
 		if err != nil {
 			return zero, err
 		}
 		return validateType(tmp, typ)
 	case *parse.IdentifierNode:
-		tmp, err := evalFunction(arg, data, arg, nil, zero)
+		tmp, err := s.evalFunction(arg, arg, nil, zero)
+		if err != nil {
+			return zero, err
+		}
+		return validateType(tmp, typ)
+	case *parse.VariableNode:
+		tmp, err := s.evalVariableNode(arg, nil, zero)
 		if err != nil {
+			if isMissing(err) && typ != nil && canBeNil(typ) {
+				return reflect.Zero(typ), nil
+			}
 			return zero, err
 		}
 		return validateType(tmp, typ)
+	case *parse.DotNode:
+		return validateType(s.dotValue(), typ)
 	case *parse.ChainNode:
-		tmp, err := evalChainNode(arg, data, nil, zero)
+		tmp, err := s.evalChainNode(arg, nil, zero)
 		if err != nil {
+			if isMissing(err) && typ != nil && canBeNil(typ) {
+				return reflect.Zero(typ), nil
+			}
 			return zero, err
 		}
 		return validateType(tmp, typ)
@@ -312,7 +635,7 @@ func evalArg(n parse.Node, data Data, typ reflect.Type) (reflect.Value, error) {
 		return evalInteger(typ, n)
 	case reflect.Interface:
 		if typ.NumMethod() == 0 {
-			return evalEmptyInterface(n, data)
+			return s.evalEmptyInterface(n)
 		}
 	case reflect.String:
 		return evalString(typ, n)
@@ -376,14 +699,14 @@ func evalComplex(typ reflect.Type, n parse.Node) (reflect.Value, error) {
 	return zero, errors.Errorf("expected complex; found %s", n)
 }
 
-func evalEmptyInterface(n parse.Node, data Data) (reflect.Value, error) {
+func (s *state) evalEmptyInterface(n parse.Node) (reflect.Value, error) {
 	switch n := n.(type) {
 	case *parse.BoolNode:
 		return reflect.ValueOf(n.True), nil
 	case *parse.FieldNode:
-		return evalFieldNode(n, data, nil, zero)
+		return s.evalFieldNode(n, nil, zero)
 	case *parse.IdentifierNode:
-		return evalFunction(n, data, n, nil, zero)
+		return s.evalFunction(n, n, nil, zero)
 	case *parse.NilNode:
 		// NilNode is handled in evalArg, the only place that calls here.
 		return zero, errors.Errorf("evalEmptyInterface: nil (can't happen)")
@@ -392,7 +715,7 @@ func evalEmptyInterface(n parse.Node, data Data) (reflect.Value, error) {
 	case *parse.StringNode:
 		return reflect.ValueOf(n.Text), nil
 	case *parse.PipeNode:
-		return evalPipeline(n, data)
+		return s.evalPipeline(n)
 	}
 	return zero, errors.Errorf("can't handle assignment of %s to empty interface argument", n)
 }
@@ -400,7 +723,7 @@ func evalEmptyInterface(n parse.Node, data Data) (reflect.Value, error) {
 // evalCall executes a function or method call. If it's a method, fun already has the receiver bound, so
 // it looks just like a function call.  The arg list, if non-nil, includes (in the manner of the shell), arg[0]
 // as the function itself.
-func evalCall(fun reflect.Value, args []parse.Node, data Data, name string, final reflect.Value) (reflect.Value, error) {
+func (s *state) evalCall(fun reflect.Value, args []parse.Node, name string, final reflect.Value) (reflect.Value, error) {
 	var err error
 	if args != nil {
 		args = args[1:] // Zeroth arg is function name/node; not passed to function.
@@ -428,7 +751,7 @@ func evalCall(fun reflect.Value, args []parse.Node, data Data, name string, fina
 	// Args must be evaluated. Fixed args first.
 	i := 0
 	for ; i < numFixed && i < len(args); i++ {
-		argv[i], err = evalArg(args[i], data, typ.In(i))
+		argv[i], err = s.evalArg(args[i], typ.In(i))
 		if err != nil {
 			return zero, err
 		}
@@ -437,7 +760,7 @@ func evalCall(fun reflect.Value, args []parse.Node, data Data, name string, fina
 	if typ.IsVariadic() {
 		argType := typ.In(typ.NumIn() - 1).Elem() // Argument is a slice.
 		for ; i < len(args); i++ {
-			argv[i], err = evalArg(args[i], data, argType)
+			argv[i], err = s.evalArg(args[i], argType)
 			if err != nil {
 				return zero, err
 			}
@@ -558,3 +881,23 @@ func validateType(value reflect.Value, typ reflect.Type) (reflect.Value, error)
 func isHexConstant(s string) bool {
 	return len(s) > 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X')
 }
+
+// printableValue returns the interface of the value, nil is returned if it is invalid.
+func printableValue(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// sortKeys sorts the map keys, so range over map is in a stable order.
+func sortKeys(keys []reflect.Value) []reflect.Value {
+	sort.Slice(keys, func(i, j int) bool {
+		c, err := lt(keys[i].Interface(), keys[j].Interface())
+		if err != nil {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		}
+		return c
+	})
+	return keys
+}
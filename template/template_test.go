@@ -1,7 +1,14 @@
 package template
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 var (
@@ -93,3 +100,699 @@ func TestExecute(t *testing.T) {
 		}
 	}
 }
+
+func TestNewWithFuncs(t *testing.T) {
+	funcs := map[string]interface{}{
+		"double": func(n int) int { return n * 2 },
+		"check": func(s string) (bool, error) {
+			if s == "" {
+				return false, errors.New("empty string")
+			}
+			return true, nil
+		},
+	}
+	tmp, err := NewWithFuncs("{{ double .age }}", funcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, err := tmp.Execute(ctx); err != nil || result != 56 {
+		t.Errorf("double .age = %v, %v", result, err)
+	}
+	if _, err := Parse("{{ double .age }}", ctx); err == nil {
+		t.Error("function should not be defined in template created by Parse")
+	}
+	if result, err := Parse("{{ eq .age 28 }}", ctx); err != nil || result != true {
+		t.Errorf("builtins should be kept, got %v, %v", result, err)
+	}
+	tmp, err = NewWithFuncs("{{ check .emptystr }}", funcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tmp.Execute(ctx); err == nil {
+		t.Error("error returned by function should be returned")
+	}
+
+	bad := []map[string]interface{}{
+		{"notfunc": 1},
+		{"noresult": func() {}},
+		{"badresult": func() (int, int) { return 1, 2 }},
+		{"bad-name": func() int { return 1 }},
+	}
+	for _, funcs := range bad {
+		if _, err := NewWithFuncs("{{ 1 }}", funcs); err == nil {
+			t.Errorf("%v should be refused", funcs)
+		}
+		if err := Funcs(funcs); err == nil {
+			t.Errorf("%v should be refused", funcs)
+		}
+	}
+
+	if err := Funcs(map[string]interface{}{"greet": func(s string) string { return "hello " + s }}); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := Parse("{{ greet .name }}", ctx); err != nil || result != "hello jack" {
+		t.Errorf("greet .name = %v, %v", result, err)
+	}
+}
+
+func TestStdFuncs(t *testing.T) {
+	data := Context{data: map[string]interface{}{
+		"name":  "Jack",
+		"tags":  []string{"a", "b", "c"},
+		"csv":   "x,y,z",
+		"num":   "42",
+		"float": "1.5",
+		"empty": "",
+	}}
+	table := []struct {
+		template string
+		answer   interface{}
+	}{
+		{`{{ printf "%s is %d" .name 28 }}`, "Jack is 28"},
+		{`{{ lower .name }}`, "jack"},
+		{`{{ .name | upper }}`, "JACK"},
+		{`{{ join "," .tags }}`, "a,b,c"},
+		{`{{ .csv | split "," | join "-" }}`, "x-y-z"},
+		{`{{ .missing | default "none" }}`, "none"},
+		{`{{ .empty | default "none" }}`, "none"},
+		{`{{ default "none" .name }}`, "Jack"},
+		{`{{ default "none" .missing }}`, "none"},
+		{`{{ toInt .num }}`, int64(42)},
+		{`{{ .float | toFloat }}`, 1.5},
+		{`{{ toInt .float }}`, int64(1)},
+		{`{{ duration "1m30s" }}`, 90 * time.Second},
+		{`{{ duration 2 }}`, 2 * time.Second},
+	}
+	for _, item := range table {
+		result, err := Parse(item.template, data)
+		if err != nil {
+			t.Errorf("%s: %s", item.template, err)
+			continue
+		}
+		if result != item.answer {
+			t.Errorf("%s = %#v, want %#v", item.template, result, item.answer)
+		}
+	}
+
+	result, err := Parse("{{ now }}", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := result.(time.Time); !ok {
+		t.Errorf("now should return time.Time, got %T", result)
+	}
+	for _, s := range []string{`{{ toInt .name }}`, `{{ duration "abc" }}`, `{{ .missing }}`, `{{ .missing | lower }}`} {
+		if _, err := Parse(s, data); err == nil {
+			t.Errorf("%s should fail", s)
+		}
+	}
+}
+
+func TestControl(t *testing.T) {
+	data := Context{data: map[string]interface{}{
+		"name":  "jack",
+		"age":   28,
+		"list":  []int{1, 2, 3, 4, 5},
+		"empty": []string{},
+		"tags": map[string]string{
+			"host": "web-1",
+			"dc":   "bj",
+		},
+		"parents": map[string]interface{}{
+			"father": map[string]interface{}{"name": "tom"},
+		},
+	}}
+	table := []struct {
+		template string
+		answer   interface{}
+	}{
+		{`{{ if gt .age 18 }}adult{{ else }}child{{ end }}`, "adult"},
+		{`{{ if lt .age 18 }}child{{ else if lt .age 60 }}adult{{ else }}old{{ end }}`, "adult"},
+		{`{{ if .missing }}yes{{ else }}no{{ end }}`, "no"},
+		{`{{ with .parents.father }}{{ .name }}{{ end }}`, "tom"},
+		{`{{ with .missing }}{{ . }}{{ else }}none{{ end }}`, "none"},
+		{`{{ range .list }}{{ . }}{{ end }}`, "12345"},
+		{`{{ range $i, $v := .list }}{{ $i }}:{{ $v }} {{ end }}`, "0:1 1:2 2:3 3:4 4:5 "},
+		{`{{ range $k, $v := .tags }}{{ $k }}={{ $v }},{{ end }}`, "dc=bj,host=web-1,"},
+		{`{{ range .empty }}{{ . }}{{ else }}empty{{ end }}`, "empty"},
+		{`{{ range .missing }}{{ . }}{{ else }}empty{{ end }}`, "empty"},
+		{`{{ range .list }}{{ if eq . 2 }}{{ continue }}{{ end }}{{ if eq . 4 }}{{ break }}{{ end }}{{ . }}{{ end }}`, "13"},
+		{`{{ range .list }}{{ $.name }}{{ break }}{{ end }}`, "jack"},
+		{`{{ range .list }}{{ $ | printf "%T" }};{{ end }}`, "template.Context;template.Context;template.Context;template.Context;template.Context;"},
+		{`{{ with .parents.father }}{{ $ | printf "%T" }}{{ $.name }}{{ end }}`, "template.Contextjack"},
+		{`{{ with .parents }}{{ $x := $ }}{{ $x.age }}{{ end }}`, "28"},
+		{`{{ $x := .age }}{{ $x }}`, "28"},
+		{`{{ $x := 1 }}{{ range .list }}{{ $x = . }}{{ end }}{{ $x }}`, "5"},
+		{`{{ range 3 }}{{ . }}{{ end }}`, "012"},
+		{`{{ $x := .name }}`, ""},
+		// a single action still returns the typed value
+		{`{{ .age }}`, 28},
+	}
+	for _, item := range table {
+		result, err := Parse(item.template, data)
+		if err != nil {
+			t.Errorf("%s: %s", item.template, err)
+			continue
+		}
+		if result != item.answer {
+			t.Errorf("%s = %#v, want %#v", item.template, result, item.answer)
+		}
+	}
+	for _, s := range []string{`{{ range .name }}{{ . }}{{ end }}`, `{{ if .age.x }}{{ end }}`, `{{ $y }}`} {
+		if _, err := Parse(s, data); err == nil {
+			t.Errorf("%s should fail", s)
+		}
+	}
+}
+
+type fakeKeySpace map[string]string
+
+func (f fakeKeySpace) Get(key string) (string, error) {
+	if v, ok := f[key]; ok {
+		return v, nil
+	}
+	return "", errors.New("key not found")
+}
+
+func (f fakeKeySpace) Keys(prefix string) []string {
+	var keys []string
+	for key := range f {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+type server struct {
+	Host  string            `json:"host"`
+	Port  int               `json:"port"`
+	Tags  map[string]string `json:"tags"`
+	Owner *person
+}
+
+type person struct {
+	Name string `json:"name"`
+}
+
+func TestData(t *testing.T) {
+	srv := &server{
+		Host:  "web-1",
+		Port:  8080,
+		Tags:  map[string]string{"dc": "bj"},
+		Owner: &person{Name: "jack"},
+	}
+	conf := fakeKeySpace{
+		"/app/name":       "demo",
+		"/app/db/host":    "10.0.0.1",
+		"/app/db/port":    "3306",
+		"/other/password": "secret",
+	}
+	maps := MapData{
+		"server": srv,
+		"env": map[string]interface{}{
+			"region": map[string]interface{}{"name": "north"},
+		},
+		"yaml": map[interface{}]interface{}{"key": "value"},
+		"name": "from map",
+	}
+	table := []struct {
+		data     Data
+		template string
+		answer   interface{}
+	}{
+		{maps, `{{ .env.region.name }}`, "north"},
+		{maps, `{{ .yaml.key }}`, "value"},
+		{maps, `{{ .server.port }}`, 8080},
+		{maps, `{{ .server.Owner.name }}`, "jack"},
+		{maps, `{{ .server.tags.dc }}`, "bj"},
+		{StructData(srv), `{{ .host }}:{{ .Port }}`, "web-1:8080"},
+		{StructData(*srv), `{{ .Owner.Name }}`, "jack"},
+		{DConfData(conf, "/app"), `{{ .name }}`, "demo"},
+		{DConfData(conf, "/app/"), `{{ .db.host }}:{{ .db.port }}`, "10.0.0.1:3306"},
+		{DConfData(conf, ""), `{{ .app.db.host }}`, "10.0.0.1"},
+		{Chain(maps, DConfData(conf, "/app")), `{{ .name }}`, "from map"},
+		{Chain(nil, MapData{}, DConfData(conf, "/app")), `{{ .db.port }}`, "3306"},
+		{Chain(maps, DConfData(conf, "/app")), `{{ .db.missing | default "none" }}`, "none"},
+	}
+	for _, item := range table {
+		result, err := Parse(item.template, item.data)
+		if err != nil {
+			t.Errorf("%s: %s", item.template, err)
+			continue
+		}
+		if result != item.answer {
+			t.Errorf("%s = %#v, want %#v", item.template, result, item.answer)
+		}
+	}
+	for _, s := range []string{`{{ .password }}`, `{{ .db.user }}`} {
+		if _, err := Parse(s, DConfData(conf, "/app")); err == nil {
+			t.Errorf("%s should fail", s)
+		}
+	}
+	if _, err := Parse(`{{ .server.Missing }}`, maps); err == nil {
+		t.Error(".server.Missing should fail")
+	}
+}
+
+func TestStaticCheck(t *testing.T) {
+	tmp, err := New(`{{ if gt .age 18 }}{{ .name | upper }}{{ end }}
+{{ range $k, $v := .tags }}{{ $k }}={{ .x }}{{ end }}{{ with .parents }}{{ .father }}{{ end }}{{ $.server.host }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields := strings.Join(tmp.Fields(), ","); fields != ".age,.name,.parents,.parents.father,.server.host,.tags" {
+		t.Errorf("Fields() = %s", fields)
+	}
+	if funcs := strings.Join(tmp.Funcs(), ","); funcs != "gt,upper" {
+		t.Errorf("Funcs() = %s", funcs)
+	}
+
+	schema := Schema{
+		"name":    "",
+		"age":     0,
+		"tags":    map[string]string{},
+		"parents": map[string]string{},
+		"server":  server{},
+		"extra":   nil,
+		"incr":    func(n int) int { return n + 1 },
+	}
+	if err := tmp.Validate(schema); err == nil {
+		t.Error(".x of string element should be reported")
+	} else if errs := err.(ValidationErrors); len(errs) != 1 || errs[0].Line != 2 || errs[0].Column != 40 {
+		t.Errorf("unexpected validation errors: %v", err)
+	}
+
+	valid := []string{
+		`{{ .name }} is {{ .age }}`,
+		`{{ .server.Owner.name }}`,
+		`{{ .extra.anything.goes }}`,
+		`{{ range .tags }}{{ lower . }}{{ end }}`,
+		`{{ $s := .server }}{{ $s.Port }}`,
+		`{{ .incr .age }}`,
+		`{{ printf "%d" (.incr .age) }}`,
+		`{{ .name | default "jack" | upper }}`,
+	}
+	for _, s := range valid {
+		tmp, err := New(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tmp.Validate(schema); err != nil {
+			t.Errorf("%s: %s", s, err)
+		}
+	}
+
+	invalid := []struct {
+		template string
+		message  string
+	}{
+		{`{{ .missing }}`, "1:4: unknown field .missing"},
+		{`{{ $s := .server }}{{ $s.Owner.age }}`, "1:23: unknown field .server.Owner.age"},
+		{`{{ .server.Owner.age }}`, "1:4: unknown field .server.Owner.age"},
+		{"a\n  {{ .server.Missing }}", "2:6: unknown field .server.Missing"},
+		{`{{ upper .age }}`, "1:10: wrong type for argument 1 of upper: expected string, got .age of type int"},
+		{`{{ .age | lower }}`, "1:11: wrong type for argument 1 of lower: expected string, got .age of type int"},
+		{`{{ upper 1 }}`, "1:10: wrong type for argument 1 of upper: expected string, got 1"},
+		{`{{ split "," }}`, "1:4: wrong number of args for split: want 2 got 1"},
+		{`{{ range .name }}{{ end }}`, "1:10: range can't iterate over string"},
+		{`{{ with .server }}{{ .Port | upper }}{{ end }}`, "1:30: wrong type for argument 1 of upper: expected string, got .server.Port of type int"},
+	}
+	for _, item := range invalid {
+		tmp, err := New(item.template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tmp.Validate(schema); err == nil || err.Error() != item.message {
+			t.Errorf("%s: got %v, want %s", item.template, err, item.message)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	data := MapData{
+		"name": "jack",
+		"born": time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC),
+		"incr": func(n int) int { return n + 1 },
+		"crash": func() int {
+			var m map[string]int
+			m["a"] = 1
+			return 0
+		},
+	}
+	execute := func(s string, policy *Policy) (interface{}, error) {
+		tmp, err := New(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tmp.ExecuteContext(context.Background(), data, policy)
+	}
+
+	limited := []struct {
+		template string
+		policy   Policy
+		limit    string
+	}{
+		{`{{ range 1000000 }}{{ end }}`, Policy{MaxSteps: 1000}, LimitSteps},
+		{`{{ range 100 }}{{ $.name }}{{ end }}`, Policy{MaxOutput: 100}, LimitOutput},
+		{`{{ printf "%0200d" 1 }}`, Policy{MaxOutput: 100}, LimitOutput},
+		{`{{ upper .name }}`, Policy{Funcs: []string{"lower"}}, LimitCall},
+		{`{{ .born.Format "2006" }}`, Policy{Methods: []string{"Year"}}, LimitCall},
+		{`{{ .incr 1 }}`, Policy{Methods: []string{}}, LimitCall},
+	}
+	for _, item := range limited {
+		_, err := execute(item.template, &item.policy)
+		if err == nil || !IsLimitError(err) {
+			t.Errorf("%s: should hit the %s limit, got %v", item.template, item.limit, err)
+			continue
+		}
+		if limit := errors.Cause(err).(*LimitError).Limit; limit != item.limit {
+			t.Errorf("%s: should hit the %s limit, got %s", item.template, item.limit, limit)
+		}
+	}
+
+	allowed := []struct {
+		template string
+		policy   Policy
+		answer   interface{}
+	}{
+		{`{{ range 10 }}{{ . }}{{ end }}`, Policy{MaxSteps: 1000, MaxOutput: 10}, "0123456789"},
+		{`{{ lower .name }}`, Policy{Funcs: []string{"lower"}}, "jack"},
+		{`{{ .born.Format "2006" }}`, Policy{Methods: []string{"time.Time.Format"}}, "2000"},
+		{`{{ .born.Year }}`, Policy{Methods: []string{"Year"}}, 2000},
+		{`{{ .incr 1 }}`, Policy{Methods: []string{"incr"}}, 2},
+	}
+	for _, item := range allowed {
+		result, err := execute(item.template, &item.policy)
+		if err != nil {
+			t.Errorf("%s: %s", item.template, err)
+			continue
+		}
+		if result != item.answer {
+			t.Errorf("%s = %#v, want %#v", item.template, result, item.answer)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	tmp, err := New(`{{ range 1000000000 }}{{ end }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tmp.ExecuteContext(ctx, data, nil); !IsLimitError(err) {
+		t.Errorf("should be stopped by context, got %v", err)
+	}
+
+	if _, err := execute(`{{ .crash }}`, nil); err == nil {
+		t.Error("panic in function should be returned as error")
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := NewCache(2)
+	for _, s := range []string{"{{ .a }}", "{{ .b }}", "{{ .a }}", "{{ .c }}", "{{ .b }}"} {
+		if _, err := c.Get(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// .b is evicted by .c, since .a is used recently
+	if stats := c.Stats(); stats != (CacheStats{Size: 2, Capacity: 2, Hits: 1, Misses: 4, Evictions: 2}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	first, _ := c.Get("{{ .b }}")
+	second, _ := c.Get("{{ .b }}")
+	if first != second {
+		t.Error("template should be cached")
+	}
+	if _, err := c.Get("{{ .a "); err == nil {
+		t.Error("invalid template should fail")
+	}
+	c.Resize(0)
+	if stats := c.Stats(); stats.Size != 0 {
+		t.Errorf("cache should be empty, got %+v", stats)
+	}
+
+	var wg sync.WaitGroup
+	c = NewCache(10)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tmp, err := c.Get(fmt.Sprintf("{{ .name }}-%d", (i+j)%20))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := tmp.Execute(ctx); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if stats := c.Stats(); stats.Hits+stats.Misses != 800 || stats.Size != 10 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// the template parsed while clearing is not cached, it may use the old functions
+	c = NewCache(10)
+	stale, err := c.get("{{ .name }}", func(s string) (*Template, error) {
+		c.Clear()
+		return New(s)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := c.Stats(); stats.Size != 0 {
+		t.Errorf("template parsed before Clear should not be cached, got %+v", stats)
+	}
+	if fresh, _ := c.Get("{{ .name }}"); fresh == stale {
+		t.Error("template should be parsed again after Clear")
+	}
+
+	before := ParseCacheStats()
+	for i := 0; i < 3; i++ {
+		if _, err := Parse("{{ .name }} cached", ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if after := ParseCacheStats(); after.Hits-before.Hits < 2 {
+		t.Errorf("Parse should use cache, before %+v, after %+v", before, after)
+	}
+}
+
+func TestMustNew(t *testing.T) {
+	if tmp := MustNew("{{ .name }}"); tmp.String() != "{{ .name }}" {
+		t.Error("unexpected template")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("MustNew should panic on invalid template")
+		}
+	}()
+	MustNew("{{ .name ")
+}
+
+func BenchmarkExecute(b *testing.B) {
+	s := `{{ if gt .age 18 }}{{ .name | upper }} is {{ .age }}{{ end }}`
+	b.Run("New", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			tmp, err := New(s)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := tmp.Execute(ctx); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Cached", func(b *testing.B) {
+		c := NewCache(DefaultCacheSize)
+		for i := 0; i < b.N; i++ {
+			tmp, err := c.Get(s)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := tmp.Execute(ctx); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Parse", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := Parse(s, ctx); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestRender(t *testing.T) {
+	data := MapData{
+		"host":  "web-1",
+		"port":  8080,
+		"debug": true,
+		"tags":  map[string]string{"dc": "bj"},
+		"list":  []int{1, 2},
+	}
+	doc := `{
+		"server": {"host": "{{ .host }}", "port": "{{ .port }}", "addr": "{{ .host }}:{{ .port }}"},
+		"debug": "{{ .debug }}",
+		"tags": "{{ .tags }}",
+		"items": ["{{ .port }}", 1.50, null, "plain", {"n": "{{ .list }}"}],
+		"{{ .key }}": 12345678901234567890
+	}`
+	result, err := RenderJSON([]byte(doc), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"server":{"host":"web-1","port":8080,"addr":"web-1:8080"},"debug":true,"tags":{"dc":"bj"},` +
+		`"items":[8080,1.50,null,"plain",{"n":[1,2]}],"{{ .key }}":12345678901234567890}`
+	if string(result) != expected {
+		t.Errorf("RenderJSON() = %s\nwant %s", result, expected)
+	}
+
+	invalid := []struct {
+		doc     string
+		message string
+	}{
+		{`{"a": [1, {"b": "{{ .missing }}"}]}`, "$.a[1].b"},
+		{`{"a": "{{ .port "}`, "$.a"},
+		{`{"a": 1,}`, "invalid JSON"},
+		{`{"a": 1} {}`, "invalid JSON"},
+	}
+	for _, item := range invalid {
+		if _, err := RenderJSON([]byte(item.doc), data); err == nil || !strings.HasPrefix(err.Error(), item.message) {
+			t.Errorf("%s: got error %v, want %s", item.doc, err, item.message)
+		}
+	}
+
+	tree := map[interface{}]interface{}{
+		"port":  "{{ .port }}",
+		"hosts": []interface{}{"{{ .host }}", 1},
+	}
+	rendered, err := Render(tree, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := rendered.(map[interface{}]interface{}); m["port"] != 8080 || m["hosts"].([]interface{})[0] != "web-1" {
+		t.Errorf("unexpected Render() result %v", rendered)
+	}
+	if tree["port"] != "{{ .port }}" {
+		t.Error("Render() should not modify the document")
+	}
+	if _, err := Render(map[string]interface{}{"a": []interface{}{"{{ .missing }}"}}, data); err == nil || !strings.HasPrefix(err.Error(), "$.a[0]") {
+		t.Errorf("error should be prefixed by path, got %v", err)
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	data := MapData{
+		"a":     3,
+		"b":     int64(4),
+		"u":     uint(7),
+		"f":     1.5,
+		"small": int8(100),
+		"s":     "  hello world  ",
+		"list":  []string{"a", "b", "c", "d"},
+		"nums":  []int{1, 2, 3},
+		"tags":  map[string]string{"env": "prod"},
+		"nested": map[string]interface{}{
+			"list": []interface{}{map[string]int{"x": 1}},
+		},
+		"ok":    true,
+		"empty": "",
+	}
+	table := []struct {
+		template string
+		answer   interface{}
+	}{
+		// add
+		{`{{ add .a 1 }}`, 4},
+		{`{{ add .a .b }}`, int64(7)},
+		{`{{ add .a .f }}`, 4.5},
+		{`{{ add .u .a }}`, int64(10)},
+		{`{{ add .u .u }}`, uint(14)},
+		{`{{ add .small 100 }}`, int64(200)},
+		// sub
+		{`{{ sub .a 5 }}`, -2},
+		{`{{ sub .f 0.5 }}`, 1.0},
+		{`{{ sub .u 10 }}`, int64(-3)},
+		// mul
+		{`{{ mul .a .b }}`, int64(12)},
+		{`{{ mul .f 2 }}`, 3.0},
+		// div
+		{`{{ div 7 2 }}`, 3},
+		{`{{ div 7 2.0 }}`, 3.5},
+		// mod
+		{`{{ mod 7 3 }}`, 1},
+		{`{{ mod 7.5 2 }}`, 1.5},
+		// index
+		{`{{ index .list 1 }}`, "b"},
+		{`{{ index .tags "env" }}`, "prod"},
+		{`{{ index .tags "missing" }}`, ""},
+		{`{{ index .nested "list" 0 "x" }}`, 1},
+		// slice
+		{`{{ slice .list 1 3 | join "," }}`, "b,c"},
+		{`{{ slice .list 2 | join "," }}`, "c,d"},
+		{`{{ slice "hello" 1 3 }}`, "el"},
+		// len
+		{`{{ len .list }}`, 4},
+		{`{{ len .tags }}`, 1},
+		{`{{ len "abc" }}`, 3},
+		// printf
+		{`{{ printf "%.2f" .f }}`, "1.50"},
+		{`{{ printf "%d-%s" .a "x" }}`, "3-x"},
+		// contains
+		{`{{ contains "world" .s }}`, true},
+		{`{{ .list | contains "c" }}`, true},
+		{`{{ contains 4 .nums }}`, false},
+		{`{{ contains "env" .tags }}`, true},
+		// replace
+		{`{{ replace "world" "jack" .s }}`, "  hello jack  "},
+		// trim
+		{`{{ trim .s }}`, "hello world"},
+		// default
+		{`{{ .empty | default "none" }}`, "none"},
+		{`{{ .a | default 1 }}`, 3},
+		// coalesce
+		{`{{ coalesce .missing .empty "first" "second" }}`, "first"},
+		{`{{ coalesce .missing .empty }}`, nil},
+		// ternary
+		{`{{ ternary "yes" "no" .ok }}`, "yes"},
+		{`{{ .empty | ternary "yes" "no" }}`, "no"},
+		// combined
+		{`{{ add (len .list) (index .nums 2) }}`, 7},
+	}
+	for _, item := range table {
+		result, err := Parse(item.template, data)
+		if err != nil {
+			t.Errorf("%s: %s", item.template, err)
+			continue
+		}
+		if result != item.answer {
+			t.Errorf("%s = %#v (%T), want %#v (%T)", item.template, result, result, item.answer, item.answer)
+		}
+	}
+
+	invalid := []string{
+		`{{ add .s 1 }}`,
+		`{{ add .small .small }}`,
+		`{{ div .a 0 }}`,
+		`{{ mod .f 0 }}`,
+		`{{ sub .u (add .u .u) }}`,
+		`{{ index .list 4 }}`,
+		`{{ index .a 0 }}`,
+		`{{ slice .list 3 1 }}`,
+		`{{ slice .a 1 }}`,
+		`{{ len .a }}`,
+		`{{ contains 1 .s }}`,
+	}
+	for _, s := range invalid {
+		if _, err := Parse(s, data); err == nil {
+			t.Errorf("%s should fail", s)
+		}
+	}
+}
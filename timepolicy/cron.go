@@ -0,0 +1,249 @@
+package timepolicy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cron 表达式的宏
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	monthNames = map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}
+	weekdayNames = map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}
+)
+
+// cronField 是 cron 表达式中一个字段的取值范围
+type cronField struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	secondField  = cronField{0, 59, nil}
+	minuteField  = cronField{0, 59, nil}
+	hourField    = cronField{0, 23, nil}
+	domField     = cronField{1, 31, nil}
+	monthField   = cronField{1, 12, monthNames}
+	weekdayField = cronField{0, 7, weekdayNames} // 0 和 7 都是周日
+)
+
+// allHours 是每个小时都匹配的位图
+const allHours = 1<<24 - 1
+
+// cronSchedule 是解析后的 cron 表达式, 每个字段用位图表示可以匹配的值
+type cronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	domStar, dowStar                      bool // 日期和星期是否为 *, 都不是 * 时满足其中一个即可
+	loc                                   *time.Location
+}
+
+// isCronSpec 判断策略项是否是 cron 表达式, cron 表达式包含空格或者以 @ 开头
+func isCronSpec(s []byte) bool {
+	s = trimSpace(s)
+	return len(s) > 0 && (s[0] == '@' || strings.ContainsAny(string(s), " \t"))
+}
+
+func trimSpace(s []byte) []byte {
+	return []byte(strings.TrimSpace(string(s)))
+}
+
+// parseCron 解析 cron 表达式, 支持:
+//   - 5 个字段: 分 时 日 月 星期, 6 个字段: 秒 分 时 日 月 星期
+//   - *, ?, 数字, 范围 a-b, 步长 */n 和 a-b/n, 列表 a,b,c, 月份和星期可以使用英文缩写 JAN, MON
+//   - @yearly, @monthly, @weekly, @daily, @hourly 这样的宏
+//   - 以 TZ=Asia/Shanghai 或 CRON_TZ=Asia/Shanghai 开头指定时区, 否则使用 loc
+func parseCron(spec string, loc *time.Location) (*cronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "TZ=") || strings.HasPrefix(spec, "CRON_TZ=") {
+		i := strings.IndexAny(spec, " \t")
+		if i < 0 {
+			return nil, fmt.Errorf("uncorrect cron expression '%s': missing fields", spec)
+		}
+		name := spec[strings.IndexByte(spec, '=')+1 : i]
+		l, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, fmt.Errorf("uncorrect time zone '%s': %s", name, err.Error())
+		}
+		loc = l
+		spec = strings.TrimSpace(spec[i:])
+	}
+	if strings.HasPrefix(spec, "@") {
+		expr, ok := cronMacros[strings.ToLower(spec)]
+		if !ok {
+			return nil, fmt.Errorf("unknown cron macro '%s'", spec)
+		}
+		spec = expr
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("uncorrect cron expression '%s': expected 5 or 6 fields, found %d", spec, len(fields))
+	}
+
+	schedule := &cronSchedule{
+		domStar: fields[3] == "*" || fields[3] == "?",
+		dowStar: fields[5] == "*" || fields[5] == "?",
+		loc:     loc,
+	}
+	var err error
+	for i, item := range []struct {
+		bits  *uint64
+		field cronField
+	}{
+		{&schedule.second, secondField},
+		{&schedule.minute, minuteField},
+		{&schedule.hour, hourField},
+		{&schedule.dom, domField},
+		{&schedule.month, monthField},
+		{&schedule.dow, weekdayField},
+	} {
+		if *item.bits, err = parseCronField(fields[i], item.field); err != nil {
+			return nil, fmt.Errorf("uncorrect cron expression '%s': %s", spec, err.Error())
+		}
+	}
+	if schedule.dow&(1<<7) != 0 { // 7 也是周日
+		schedule.dow |= 1
+	}
+	return schedule, nil
+}
+
+// parseCronField 解析一个字段, 返回可以匹配的值的位图
+func parseCronField(s string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		rangePart, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("uncorrect step in '%s'", part)
+			}
+			rangePart, step = part[:i], n
+		}
+
+		var start, end int
+		switch {
+		case rangePart == "*" || rangePart == "?":
+			start, end = field.min, field.max
+			if field.max == 7 { // 星期的 * 是 0-6
+				end = 6
+			}
+		case strings.IndexByte(rangePart, '-') > 0:
+			i := strings.IndexByte(rangePart, '-')
+			var err error
+			if start, err = field.value(rangePart[:i]); err != nil {
+				return 0, err
+			}
+			if end, err = field.value(rangePart[i+1:]); err != nil {
+				return 0, err
+			}
+			if start > end {
+				return 0, fmt.Errorf("uncorrect range '%s'", rangePart)
+			}
+		default:
+			var err error
+			if start, err = field.value(rangePart); err != nil {
+				return 0, err
+			}
+			end = start
+			if step > 1 { // n/step 表示从 n 开始到最大值
+				end = field.max
+			}
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (field cronField) value(s string) (int, error) {
+	if v, ok := field.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("uncorrect value '%s'", s)
+	}
+	if v < field.min || v > field.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", v, field.min, field.max)
+	}
+	return v, nil
+}
+
+func (schedule *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := schedule.dom&(1<<uint(t.Day())) != 0
+	dowMatch := schedule.dow&(1<<uint(t.Weekday())) != 0
+	if schedule.domStar || schedule.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// next 返回 now 之后(包括 now) 第一个匹配的时间, 按时区内的墙上时间匹配:
+// 夏令时开始时不存在的时间会被跳过, 夏令时结束时重复出现的时间只在第一次出现时执行. 5 年内都不匹配时返回 0
+func (schedule *cronSchedule) next(now int64) int64 {
+	t := time.Unix(now, 0).In(schedule.loc)
+	limit := t.Year() + 5
+
+	for t.Year() <= limit {
+		if schedule.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, schedule.loc)
+			continue
+		}
+		if !schedule.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, schedule.loc)
+			continue
+		}
+		// 时分秒按绝对时间前进, 避免在夏令时切换时 time.Date 得到不确定的时间
+		if schedule.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Add(time.Hour - time.Duration(t.Minute())*time.Minute - time.Duration(t.Second())*time.Second)
+			continue
+		}
+		if schedule.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute - time.Duration(t.Second())*time.Second)
+			continue
+		}
+		if schedule.second&(1<<uint(t.Second())) == 0 {
+			t = t.Add(time.Second)
+			continue
+		}
+		if schedule.hour != allHours && repeated(t) { // 每个小时都执行时不需要跳过
+			t = t.Add(time.Second)
+			continue
+		}
+		return t.Unix()
+	}
+	return 0
+}
+
+// repeated 判断 t 是否是夏令时结束时第二次出现的墙上时间
+func repeated(t time.Time) bool {
+	_, offset := t.Zone()
+	_, before := t.Add(-3 * time.Hour).Zone()
+	if before <= offset {
+		return false
+	}
+	earlier := t.Add(-time.Duration(before-offset) * time.Second)
+	_, earlierOffset := earlier.Zone()
+	return earlierOffset == before && earlier.Hour() == t.Hour() && earlier.Minute() == t.Minute() && earlier.Second() == t.Second()
+}
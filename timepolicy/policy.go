@@ -2,17 +2,23 @@ package timepolicy
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"sync/atomic"
 	"time"
 )
 
 const (
 	policySplit     = ','
+	cronPolicySplit = ';'
 	policyItemSplit = ':'
 )
 
 // Policy represent a group of policy item
 type Policy struct {
+	id      JobID
+	paused  bool
 	spec    string
 	items   []policyItem
 	job     Job
@@ -21,21 +27,36 @@ type Policy struct {
 	next    *Policy
 }
 
-// ParsePolicy 解析策略字符串
+// ParsePolicy 解析策略字符串, 策略由多个策略项组成, 使用 , 或 ; 分隔, 策略项有两种:
+//   - start:interval:end 三个 duration, 如 1m:10s:10m
+//   - cron 表达式, 如 30 9 * * 1-5 和 @daily, 时区默认为 from 所在的时区.
+//     cron 表达式中的 , 是字段中的列表, 所以 cron 表达式之后的策略项需要使用 ; 分隔
 func ParsePolicy(from time.Time, s string) (Policy, error) {
 	return ParsePolicyBytes(from, []byte(s))
 }
 
+// ParsePolicyInLocation 与 ParsePolicy 相同, 但是 cron 表达式使用 loc 时区
+func ParsePolicyInLocation(from time.Time, s string, loc *time.Location) (Policy, error) {
+	return parsePolicy(from, []byte(s), loc)
+}
+
 // ParsePolicyBytes 解析策略数组
 func ParsePolicyBytes(from time.Time, s []byte) (Policy, error) {
+	return parsePolicy(from, s, from.Location())
+}
+
+func parsePolicy(from time.Time, s []byte, loc *time.Location) (Policy, error) {
 	policy := Policy{
 		spec:  string(s),
 		items: make([]policyItem, 0, 4),
 	}
 	start := 0
 	for i := 0; i <= len(s); i++ {
-		if (i == len(s) || s[i] == policySplit) && i > start {
-			item, err := parsePolicyItem(from, s[start:i])
+		if i < len(s) && s[i] == policySplit && isCronSpec(s[start:i]) { // cron 表达式中的列表
+			continue
+		}
+		if (i == len(s) || s[i] == policySplit || s[i] == cronPolicySplit) && i > start {
+			item, err := parsePolicyItem(from, s[start:i], loc)
 			if err != nil {
 				return Policy{}, err
 			}
@@ -62,9 +83,18 @@ type policyItem struct {
 	Start    int64 // unix seconds
 	Interval int64 // seconds
 	End      int64 // unix seconds
+	cron     *cronSchedule
 }
 
-func parsePolicyItem(from time.Time, s []byte) (policyItem, error) {
+func parsePolicyItem(from time.Time, s []byte, loc *time.Location) (policyItem, error) {
+	if isCronSpec(s) {
+		schedule, err := parseCron(string(s), loc)
+		if err != nil {
+			return policyItem{}, err
+		}
+		return policyItem{cron: schedule}, nil
+	}
+	s = trimSpace(s)
 	var (
 		start     = 0
 		durations [3]time.Duration
@@ -124,6 +154,9 @@ func parsePolicyItem(from time.Time, s []byte) (policyItem, error) {
 }
 
 func (item policyItem) next(now int64) int64 {
+	if item.cron != nil {
+		return item.cron.next(now)
+	}
 	if item.End != 0 && now > item.End { // 已经结束
 		return 0
 	}
@@ -153,45 +186,139 @@ type Job interface {
 	Finished() bool
 }
 
+// JobID 是注册到 engine 的任务的 ID
+type JobID uint64
+
+// JobInfo 是任务的状态
+type JobInfo struct {
+	ID     JobID
+	Spec   string    // 策略字符串
+	Next   time.Time // 下一次执行的时间, 暂停的任务为零值
+	Paused bool
+}
+
+var (
+	// ErrJobNotFound 任务不存在, 或者已经结束
+	ErrJobNotFound = errors.New("job not found")
+	// ErrEngineStopped engine 的 context 已经结束
+	ErrEngineStopped = errors.New("engine stopped")
+	// ErrNilJob 注册的任务为 nil
+	ErrNilJob = errors.New("job is nil")
+	// ErrPolicyEnded 策略已经结束, 不会再执行, 任务已被删除
+	ErrPolicyEnded = errors.New("policy ended")
+)
+
 // Engine will run process the policy and run the function at a right time
 type Engine struct {
-	ctx   context.Context
-	ch    chan engineCommand
-	queue *Policy
+	lastID uint64 // 使用 atomic 访问, 放在开头保证 64 位对齐
+	ctx    context.Context
+	ch     chan engineCommand
+	queue  *Policy
+	jobs   map[JobID]*Policy // 所有的任务, 包括暂停的, 只在 activate 中访问
 }
 
 // NewEngine create a engine
 func NewEngine(ctx context.Context) *Engine {
 	engine := Engine{
-		ctx: ctx,
-		ch:  make(chan engineCommand, 10),
+		ctx:  ctx,
+		ch:   make(chan engineCommand, 10),
+		jobs: make(map[JobID]*Policy),
 	}
 	go engine.activate()
 	return &engine
 }
 
-// RegisterWithTime a policy to engine
-func (engine *Engine) RegisterWithTime(from time.Time, policy string, job Job) error {
+// RegisterWithTime a policy to engine, the ID of job is returned
+func (engine *Engine) RegisterWithTime(from time.Time, policy string, job Job) (JobID, error) {
 	if job == nil {
-		return nil
+		return 0, ErrNilJob
 	}
 	p, err := ParsePolicy(from, policy)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	p.job = job
-	engine.ch <- scheCommand{&p, time.Now()}
-	return nil
+	p.id = JobID(atomic.AddUint64(&engine.lastID, 1))
+	if !engine.send(registerCommand{&p, time.Now()}) {
+		return 0, ErrEngineStopped
+	}
+	return p.id, nil
 }
 
-// Register a policy to engine with using time.Now() as from time
-func (engine *Engine) Register(policy string, job Job) error {
+// Register a policy to engine with using time.Now() as from time, the ID of job is returned
+func (engine *Engine) Register(policy string, job Job) (JobID, error) {
 	return engine.RegisterWithTime(time.Now(), policy, job)
 }
 
+// Unregister 删除任务
+func (engine *Engine) Unregister(id JobID) error {
+	return engine.call(func(reply chan error) engineCommand { return unregisterCommand{id, reply} })
+}
+
+// Pause 暂停任务, 暂停期间任务不会被执行
+func (engine *Engine) Pause(id JobID) error {
+	return engine.call(func(reply chan error) engineCommand { return pauseCommand{id, reply} })
+}
+
+// Resume 恢复暂停的任务, 从当前时间开始计算下一次执行的时间, 策略已经结束时删除任务并返回 ErrPolicyEnded
+func (engine *Engine) Resume(id JobID) error {
+	return engine.call(func(reply chan error) engineCommand { return resumeCommand{id, reply} })
+}
+
+// Reschedule 修改任务的策略, 以当前时间作为策略的 from 时间, 暂停的任务修改后仍然是暂停的.
+// 新策略已经结束时删除任务并返回 ErrPolicyEnded
+func (engine *Engine) Reschedule(id JobID, policy string) error {
+	p, err := ParsePolicy(time.Now(), policy)
+	if err != nil {
+		return err
+	}
+	return engine.call(func(reply chan error) engineCommand { return rescheduleCommand{id, p, reply} })
+}
+
+// Jobs 返回所有任务的状态, 按 ID 排序
+func (engine *Engine) Jobs() []JobInfo {
+	reply := make(chan []JobInfo, 1)
+	if !engine.send(jobsCommand{reply}) {
+		return nil
+	}
+	select {
+	case jobs := <-reply:
+		return jobs
+	case <-engine.ctx.Done():
+		return nil
+	}
+}
+
 // Clear all the jobs
 func (engine *Engine) Clear() {
-	engine.ch <- clearCommand{}
+	engine.send(clearCommand{})
+}
+
+// send 发送命令到 activate, engine 已经停止时返回 false
+func (engine *Engine) send(cmd engineCommand) bool {
+	if engine.ctx.Err() != nil {
+		return false
+	}
+	select {
+	case engine.ch <- cmd:
+		return true
+	case <-engine.ctx.Done():
+		return false
+	}
+}
+
+// call 发送命令并等待命令执行的结果
+func (engine *Engine) call(newCommand func(reply chan error) engineCommand) error {
+	reply := make(chan error, 1)
+	if !engine.send(newCommand(reply)) {
+		return ErrEngineStopped
+	}
+	select {
+	case err := <-reply:
+		return err
+	case <-engine.ctx.Done():
+		return ErrEngineStopped
+	}
 }
 
 func (engine *Engine) activate() {
@@ -199,29 +326,71 @@ func (engine *Engine) activate() {
 	defer ticker.Stop()
 	done := engine.ctx.Done()
 
+	var fired []*Policy
 	for {
 		select {
 		case cmd := <-engine.ch:
 			cmd.execute(engine)
 		case now := <-ticker.C:
 			unix := now.Unix()
+			fired = fired[:0]
 			for engine.queue != nil && engine.queue.at <= unix {
 				iter := engine.queue
 				engine.queue = engine.queue.next
 				for iter != nil {
-					if !iter.job.Finished() {
+					brother := iter.brother
+					if iter.job.Finished() {
+						delete(engine.jobs, iter.id)
+					} else {
 						go iter.job.Do(time.Unix(iter.at, 0))
-						engine.ch <- scheCommand{iter, time.Unix(iter.at+1, 0)}
+						fired = append(fired, iter)
 					}
-					iter = iter.brother
+					iter = brother
 				}
 			}
+			// 在这里直接重新调度, 如果通过 engine.ch 发送, 同时执行的任务太多时会阻塞
+			for _, p := range fired {
+				scheCommand{p, time.Unix(p.at+1, 0)}.execute(engine)
+			}
 		case <-done:
 			return
 		}
 	}
 }
 
+// remove 将策略从队列中移除
+func (engine *Engine) remove(p *Policy) {
+	var prev *Policy
+	for head := engine.queue; head != nil; prev, head = head, head.next {
+		if head == p {
+			replacement := head.brother
+			if replacement != nil {
+				replacement.next = head.next
+			} else {
+				replacement = head.next
+			}
+			if prev != nil {
+				prev.next = replacement
+			} else {
+				engine.queue = replacement
+			}
+			break
+		}
+		found := false
+		for iter := head; iter.brother != nil; iter = iter.brother {
+			if iter.brother == p {
+				iter.brother = p.brother
+				found = true
+				break
+			}
+		}
+		if found {
+			break
+		}
+	}
+	p.next, p.brother = nil, nil
+}
+
 type engineCommand interface {
 	execute(*Engine)
 }
@@ -233,6 +402,10 @@ type scheCommand struct {
 
 func (cmd scheCommand) execute(engine *Engine) {
 	cmd.p.at = cmd.p.NextTime(cmd.from.Unix())
+	if cmd.p.at == 0 { // 策略已经结束
+		delete(engine.jobs, cmd.p.id)
+		return
+	}
 	if engine.queue == nil {
 		cmd.p.next = nil
 		cmd.p.brother = nil
@@ -254,6 +427,7 @@ func (cmd scheCommand) execute(engine *Engine) {
 			return
 		} else if iter.at > cmd.p.at {
 			cmd.p.next = iter
+			cmd.p.brother = nil
 			if prev != nil {
 				prev.next = cmd.p
 			} else {
@@ -266,11 +440,127 @@ func (cmd scheCommand) execute(engine *Engine) {
 	} // END FOR
 
 	// 加到最末尾
+	cmd.p.next = nil
+	cmd.p.brother = nil
 	prev.next = cmd.p
 }
 
+type registerCommand struct {
+	p    *Policy
+	from time.Time
+}
+
+func (cmd registerCommand) execute(engine *Engine) {
+	engine.jobs[cmd.p.id] = cmd.p
+	scheCommand{cmd.p, cmd.from}.execute(engine)
+}
+
+type unregisterCommand struct {
+	id    JobID
+	reply chan error
+}
+
+func (cmd unregisterCommand) execute(engine *Engine) {
+	p, ok := engine.jobs[cmd.id]
+	if !ok {
+		cmd.reply <- ErrJobNotFound
+		return
+	}
+	delete(engine.jobs, cmd.id)
+	if !p.paused {
+		engine.remove(p)
+	}
+	cmd.reply <- nil
+}
+
+type pauseCommand struct {
+	id    JobID
+	reply chan error
+}
+
+func (cmd pauseCommand) execute(engine *Engine) {
+	p, ok := engine.jobs[cmd.id]
+	if !ok {
+		cmd.reply <- ErrJobNotFound
+		return
+	}
+	if !p.paused {
+		engine.remove(p)
+		p.paused = true
+	}
+	cmd.reply <- nil
+}
+
+type resumeCommand struct {
+	id    JobID
+	reply chan error
+}
+
+func (cmd resumeCommand) execute(engine *Engine) {
+	p, ok := engine.jobs[cmd.id]
+	if !ok {
+		cmd.reply <- ErrJobNotFound
+		return
+	}
+	if p.paused {
+		p.paused = false
+		scheCommand{p, time.Now()}.execute(engine)
+		if p.at == 0 {
+			cmd.reply <- ErrPolicyEnded
+			return
+		}
+	}
+	cmd.reply <- nil
+}
+
+type rescheduleCommand struct {
+	id     JobID
+	policy Policy
+	reply  chan error
+}
+
+func (cmd rescheduleCommand) execute(engine *Engine) {
+	p, ok := engine.jobs[cmd.id]
+	if !ok {
+		cmd.reply <- ErrJobNotFound
+		return
+	}
+	if !p.paused {
+		engine.remove(p)
+	}
+	p.spec, p.items = cmd.policy.spec, cmd.policy.items
+	if !p.paused {
+		scheCommand{p, time.Now()}.execute(engine)
+		if p.at == 0 {
+			cmd.reply <- ErrPolicyEnded
+			return
+		}
+	}
+	cmd.reply <- nil
+}
+
+type jobsCommand struct {
+	reply chan []JobInfo
+}
+
+func (cmd jobsCommand) execute(engine *Engine) {
+	jobs := make([]JobInfo, 0, len(engine.jobs))
+	for id, p := range engine.jobs {
+		info := JobInfo{ID: id, Spec: p.spec, Paused: p.paused}
+		if !p.paused {
+			info.Next = time.Unix(p.at, 0)
+		}
+		jobs = append(jobs, info)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	cmd.reply <- jobs
+}
+
 type clearCommand struct{}
 
 func (cmd clearCommand) execute(engine *Engine) {
 	engine.queue = nil
+	for id := range engine.jobs {
+		delete(engine.jobs, id)
+	}
 }
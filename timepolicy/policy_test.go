@@ -78,7 +78,7 @@ func TestEngine(t *testing.T) {
 		from:   time.Now(),
 		t:      t,
 	}
-	err := engine.RegisterWithTime(job.from, ":2s:5s,6s:3s:10m", job)
+	_, err := engine.RegisterWithTime(job.from, ":2s:5s,6s:3s:10m", job)
 	assert.NoError(t, err)
 	time.Sleep(time.Second * 15)
 	job2 := &MockJob{
@@ -87,55 +87,55 @@ func TestEngine(t *testing.T) {
 		t:      t,
 	}
 	job.finished = true
-	err = engine.RegisterWithTime(job.from, "1s", job2)
+	_, err = engine.RegisterWithTime(job.from, "1s", job2)
 	assert.NoError(t, err)
 	time.Sleep(time.Second * 4)
 }
 
 func TestParsePolicyItem(t *testing.T) {
 	now := time.Now()
-	item, err := parsePolicyItem(now, []byte("2s"))
+	item, err := parsePolicyItem(now, []byte("2s"), time.Local)
 	assert.NoError(t, err)
 	assert.Equal(t, int64(2), item.Interval)
 
-	item, err = parsePolicyItem(now, []byte(":2s:"))
+	item, err = parsePolicyItem(now, []byte(":2s:"), time.Local)
 	assert.NoError(t, err)
 	assert.Equal(t, int64(2), item.Interval)
 
-	item, err = parsePolicyItem(now, []byte(":2s"))
+	item, err = parsePolicyItem(now, []byte(":2s"), time.Local)
 	assert.NoError(t, err)
 	assert.Equal(t, int64(2), item.Interval)
 
-	item, err = parsePolicyItem(now, []byte("10s:2s"))
+	item, err = parsePolicyItem(now, []byte("10s:2s"), time.Local)
 	assert.NoError(t, err)
 	assert.Equal(t, now.Add(time.Second*10).Unix(), item.Start)
 	assert.Equal(t, int64(2), item.Interval)
 
-	item, err = parsePolicyItem(now, []byte("10s:2s:10m"))
+	item, err = parsePolicyItem(now, []byte("10s:2s:10m"), time.Local)
 	assert.NoError(t, err)
 	assert.Equal(t, now.Add(time.Second*10).Unix(), item.Start)
 	assert.Equal(t, int64(2), item.Interval)
 	assert.Equal(t, now.Add(time.Minute*10).Unix(), item.End)
 
-	item, err = parsePolicyItem(now, []byte("::10m"))
+	item, err = parsePolicyItem(now, []byte("::10m"), time.Local)
 	assert.Error(t, err)
 
-	item, err = parsePolicyItem(now, []byte("10m::"))
+	item, err = parsePolicyItem(now, []byte("10m::"), time.Local)
 	assert.Error(t, err)
 
-	item, err = parsePolicyItem(now, []byte(":::"))
+	item, err = parsePolicyItem(now, []byte(":::"), time.Local)
 	assert.Error(t, err)
 
-	item, err = parsePolicyItem(now, []byte(""))
+	item, err = parsePolicyItem(now, []byte(""), time.Local)
 	assert.Error(t, err)
 
-	item, err = parsePolicyItem(now, []byte("::5m::"))
+	item, err = parsePolicyItem(now, []byte("::5m::"), time.Local)
 	assert.Error(t, err)
 
-	item, err = parsePolicyItem(now, []byte(":xxx:"))
+	item, err = parsePolicyItem(now, []byte(":xxx:"), time.Local)
 	assert.Error(t, err)
 
-	item, err = parsePolicyItem(now, []byte("100"))
+	item, err = parsePolicyItem(now, []byte("100"), time.Local)
 	assert.Error(t, err)
 }
 
@@ -189,3 +189,200 @@ func BenchmarkScheCommand(b *testing.B) {
 		}
 	}
 }
+
+func TestCronPolicy(t *testing.T) {
+	utc := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04:05", s)
+		assert.NoError(t, err)
+		return v
+	}
+	cases := []struct {
+		spec string
+		now  string
+		next string
+	}{
+		{"30 9 * * 1-5", "2019-11-15 10:00:00", "2019-11-18 09:30:00"}, // 周五之后是周一
+		{"30 9 * * MON-FRI", "2019-11-18 09:30:00", "2019-11-18 09:30:00"},
+		{"0 0 1 * *", "2019-01-31 12:00:00", "2019-02-01 00:00:00"},
+		{"0 0 1 * *", "2019-12-15 00:00:00", "2020-01-01 00:00:00"},
+		{"0 0 31 * *", "2019-02-01 00:00:00", "2019-03-31 00:00:00"},
+		{"0 0 29 2 *", "2019-03-01 00:00:00", "2020-02-29 00:00:00"},
+		{"0 0 13 * 5", "2019-11-16 00:00:00", "2019-11-22 00:00:00"}, // 13 号或者周五
+		{"0 0 * * 7", "2019-11-16 00:00:00", "2019-11-17 00:00:00"},
+		{"*/15 * * * * *", "2019-11-16 15:54:07", "2019-11-16 15:54:15"},
+		{"0 */20 8-10 * * *", "2019-11-16 10:41:00", "2019-11-17 08:00:00"},
+		{"0 9,18 * * *", "2019-11-16 10:00:00", "2019-11-16 18:00:00"},
+		{"@hourly", "2019-11-16 15:54:07", "2019-11-16 16:00:00"},
+		{"@daily", "2019-12-31 15:54:07", "2020-01-01 00:00:00"},
+		{"@weekly", "2019-11-16 15:54:07", "2019-11-17 00:00:00"},
+		{"@yearly", "2019-11-16 15:54:07", "2020-01-01 00:00:00"},
+		{"TZ=Asia/Shanghai 0 9 * * *", "2019-11-16 02:00:00", "2019-11-17 01:00:00"},
+		{"0 0 30 2 *", "2019-11-16 00:00:00", "0001-01-01 00:00:00"}, // 不存在的日期
+	}
+	for _, c := range cases {
+		p, err := ParsePolicyInLocation(time.Now(), c.spec, time.UTC)
+		assert.NoError(t, err, c.spec)
+		expected := utc(c.next).Unix()
+		if c.next == "0001-01-01 00:00:00" {
+			expected = 0
+		}
+		assert.Equal(t, expected, p.NextTime(utc(c.now).Unix()), c.spec)
+	}
+
+	// 时区默认为 from 所在的时区
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	assert.NoError(t, err)
+	p, err := ParsePolicy(time.Now().In(shanghai), "@daily")
+	assert.NoError(t, err)
+	assert.Equal(t, utc("2019-11-16 16:00:00").Unix(), p.NextTime(utc("2019-11-16 02:00:00").Unix()))
+
+	// cron 表达式与 duration 策略项混合使用
+	p, err = ParsePolicyInLocation(utc("2019-11-16 00:00:00"), "1h,0 30 9 * * 1,3;10m:2h", time.UTC)
+	assert.NoError(t, err)
+	assert.Len(t, p.items, 3)
+	assert.Equal(t, utc("2019-11-16 01:00:00").Unix(), p.NextTime(utc("2019-11-16 00:30:00").Unix()))
+
+	for _, spec := range []string{"61 * * * *", "* * * *", "* * * * * * *", "@foo", "TZ=Nowhere/Zone * * * * *", "5-1 * * * *", "*/0 * * * *", "* * * JAN-XYZ *"} {
+		_, err := ParsePolicy(time.Now(), spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestCronPolicyDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	at := func(s string) int64 {
+		v, err := time.ParseInLocation("2006-01-02 15:04:05 -0700", s, ny)
+		assert.NoError(t, err)
+		return v.Unix()
+	}
+
+	// 2019-03-10 02:00 EST 跳到 03:00 EDT, 02:30 不存在
+	p, err := ParsePolicyInLocation(time.Now(), "30 2 * * *", ny)
+	assert.NoError(t, err)
+	assert.Equal(t, at("2019-03-11 02:30:00 -0400"), p.NextTime(at("2019-03-10 00:00:00 -0500")))
+
+	p, _ = ParsePolicyInLocation(time.Now(), "30 3 * * *", ny)
+	assert.Equal(t, at("2019-03-10 03:30:00 -0400"), p.NextTime(at("2019-03-10 00:00:00 -0500")))
+
+	// 2019-11-03 02:00 EDT 回到 01:00 EST, 01:30 只执行一次
+	p, _ = ParsePolicyInLocation(time.Now(), "30 1 * * *", ny)
+	first := p.NextTime(at("2019-11-03 00:00:00 -0400"))
+	assert.Equal(t, at("2019-11-03 01:30:00 -0400"), first)
+	assert.Equal(t, at("2019-11-04 01:30:00 -0500"), p.NextTime(first+1))
+
+	// 每小时执行的策略在重复的小时内也会执行
+	p, _ = ParsePolicyInLocation(time.Now(), "@hourly", ny)
+	first = p.NextTime(at("2019-11-03 00:30:00 -0400"))
+	assert.Equal(t, at("2019-11-03 01:00:00 -0400"), first)
+	assert.Equal(t, at("2019-11-03 01:00:00 -0500"), p.NextTime(first+1))
+
+	// 跨越月份
+	p, _ = ParsePolicyInLocation(time.Now(), "0 9 1 * *", ny)
+	assert.Equal(t, at("2019-12-01 09:00:00 -0500"), p.NextTime(at("2019-11-01 09:00:01 -0400")))
+}
+
+func TestEngineLifecycle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	engine := NewEngine(ctx)
+
+	id1, err := engine.Register("1h", &NoneJob{})
+	assert.NoError(t, err)
+	id2, err := engine.Register("2h", &NoneJob{})
+	assert.NoError(t, err)
+	assert.NotEqual(t, id1, id2)
+
+	_, err = engine.Register("xxx", &NoneJob{})
+	assert.Error(t, err)
+	_, err = engine.Register("1h", nil)
+	assert.Equal(t, ErrNilJob, err)
+
+	jobs := engine.Jobs()
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, id1, jobs[0].ID)
+	assert.Equal(t, "1h", jobs[0].Spec)
+	assert.False(t, jobs[0].Paused)
+	assert.True(t, jobs[0].Next.After(time.Now()))
+	assert.False(t, jobs[0].Next.After(time.Now().Add(time.Hour)))
+
+	// 暂停
+	assert.NoError(t, engine.Pause(id1))
+	jobs = engine.Jobs()
+	assert.True(t, jobs[0].Paused)
+	assert.True(t, jobs[0].Next.IsZero())
+	assert.Equal(t, engine.queue.id, id2) // 暂停的任务不在队列中
+
+	// 恢复
+	assert.NoError(t, engine.Resume(id1))
+	jobs = engine.Jobs()
+	assert.False(t, jobs[0].Paused)
+	assert.Equal(t, engine.queue.id, id1)
+
+	// 修改策略
+	assert.Error(t, engine.Reschedule(id1, "xxx"))
+	assert.NoError(t, engine.Reschedule(id1, "3h"))
+	jobs = engine.Jobs()
+	assert.Equal(t, "3h", jobs[0].Spec)
+	assert.True(t, jobs[0].Next.After(time.Now()))
+	assert.False(t, jobs[0].Next.After(time.Now().Add(3*time.Hour)))
+
+	// 删除
+	assert.NoError(t, engine.Unregister(id2))
+	assert.Equal(t, ErrJobNotFound, engine.Unregister(id2))
+	assert.Equal(t, ErrJobNotFound, engine.Pause(id2))
+	assert.Equal(t, ErrJobNotFound, engine.Resume(id2))
+	assert.Equal(t, ErrJobNotFound, engine.Reschedule(id2, "1h"))
+	jobs = engine.Jobs()
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, id1, jobs[0].ID)
+
+	// 策略已经结束, 任务被删除
+	id3, err := engine.Register("1h", &NoneJob{})
+	assert.NoError(t, err)
+	assert.Equal(t, ErrPolicyEnded, engine.Reschedule(id3, "0 0 30 2 *"))
+	assert.Equal(t, ErrJobNotFound, engine.Pause(id3))
+	id3, err = engine.Register("1h", &NoneJob{})
+	assert.NoError(t, err)
+	assert.NoError(t, engine.Pause(id3))
+	assert.NoError(t, engine.Reschedule(id3, "0 0 30 2 *")) // 暂停的任务不计算下一次执行的时间
+	assert.Equal(t, ErrPolicyEnded, engine.Resume(id3))
+	assert.Equal(t, ErrJobNotFound, engine.Resume(id3))
+	assert.Len(t, engine.Jobs(), 1)
+
+	engine.Clear()
+	assert.Len(t, engine.Jobs(), 0)
+
+	cancel()
+	_, err = engine.Register("1h", &NoneJob{})
+	assert.Equal(t, ErrEngineStopped, err)
+	assert.Equal(t, ErrEngineStopped, engine.Pause(id1))
+}
+
+func TestEngineRemove(t *testing.T) {
+	engine := &Engine{}
+	now := time.Now()
+	a, _ := ParsePolicy(now, "1s")
+	b, _ := ParsePolicy(now, "1s")
+	c, _ := ParsePolicy(now, "1s")
+	d, _ := ParsePolicy(now, "10s:1s")
+	for _, p := range []*Policy{&a, &b, &c, &d} {
+		scheCommand{p, now}.execute(engine)
+	}
+	// 队列: c -> b -> a 为兄弟, 然后是 d
+	engine.remove(&b)
+	assert.Equal(t, &c, engine.queue)
+	assert.Equal(t, &a, engine.queue.brother)
+	assert.Equal(t, &d, engine.queue.next)
+
+	engine.remove(&c)
+	assert.Equal(t, &a, engine.queue)
+	assert.Nil(t, engine.queue.brother)
+	assert.Equal(t, &d, engine.queue.next)
+
+	engine.remove(&d)
+	assert.Equal(t, &a, engine.queue)
+	assert.Nil(t, engine.queue.next)
+
+	engine.remove(&a)
+	assert.Nil(t, engine.queue)
+}